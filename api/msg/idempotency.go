@@ -0,0 +1,311 @@
+package msg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"go-source/pkg/database/mongodb"
+	"go-source/pkg/database/redis"
+	logger "go-source/pkg/log"
+)
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	// defaultIdempotencyLease is how long an ID stays claimed by a handler that never finished.
+	defaultIdempotencyLease = 5 * time.Minute
+	// processedValue marks the Redis key of a processed ID, which holds a lease until then.
+	processedValue = "done"
+
+	ColProcessedMessage = "processed_message"
+	KeyProcessedMessage = "processed_message:"
+
+	// HeaderMessageID is the message header publishers set to a unique ID of the event.
+	HeaderMessageID = "x-message-id"
+)
+
+// ErrMessageInFlight fails an event whose ID is being handled elsewhere, so that it is not
+// committed before that handler finished.
+var ErrMessageInFlight = errors.New("message in flight")
+
+// errDuplicateMessage aborts the transaction of a message that was already processed.
+var errDuplicateMessage = errors.New("duplicate message")
+
+// MessageIDFunc derives the ID under which an event is recorded as processed.
+type MessageIDFunc func(event Event) string
+
+// IDFromOffset identifies an event by "<topic>/<partition>/<offset>". It catches redeliveries
+// after rebalances but not the copies republished to retry topics.
+func IDFromOffset(event Event) string {
+	return event.ID
+}
+
+// IDFromKey identifies an event by its message key, falling back to IDFromOffset.
+func IDFromKey(event Event) string {
+	if len(event.Key) == 0 {
+		return IDFromOffset(event)
+	}
+	return event.Topic + "/" + string(event.Key)
+}
+
+// IDFromHeader identifies an event by the value of header, falling back to IDFromOffset.
+// The header survives retry topics, so it also catches duplicates produced by publishers.
+func IDFromHeader(header string) MessageIDFunc {
+	return func(event Event) string {
+		if id := event.Headers[header]; id != "" {
+			return id
+		}
+		return IDFromOffset(event)
+	}
+}
+
+type idempotencyConfig struct {
+	messageID MessageIDFunc
+}
+
+type IdempotencyOption func(cfg *idempotencyConfig)
+
+// WithMessageID sets how the message ID is derived. It defaults to IDFromOffset.
+func WithMessageID(fn MessageIDFunc) IdempotencyOption {
+	return func(cfg *idempotencyConfig) {
+		if fn != nil {
+			cfg.messageID = fn
+		}
+	}
+}
+
+// IdempotencyStore remembers the IDs of handled events.
+type IdempotencyStore interface {
+	// Process runs handler unless id was already processed, and reports whether id was
+	// processed now; false with a nil error is a duplicate. An id is recorded as processed only
+	// once handler succeeded.
+	Process(ctx context.Context, id string, handler func(ctx context.Context) error) (bool, error)
+}
+
+type claimStatus int
+
+const (
+	claimAcquired claimStatus = iota
+	claimDone
+	claimInFlight
+)
+
+// leaseStore leases an ID while its handler runs, then records it as processed. A lease left
+// by a crashed handler expires after the lease TTL, so the redelivered event is handled again.
+type leaseStore interface {
+	claim(ctx context.Context, id string) (claimStatus, error)
+	complete(ctx context.Context, id string) error
+	release(ctx context.Context, id string) error
+}
+
+// processWithLease runs handler under a lease of id. An event whose ID is leased by another
+// handler fails with ErrMessageInFlight, so that it is not committed as a duplicate.
+func processWithLease(ctx context.Context, store leaseStore, id string, handler func(ctx context.Context) error) (bool, error) {
+	status, err := store.claim(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("idempotency claim: %w", err)
+	}
+	switch status {
+	case claimDone:
+		return false, nil
+	case claimInFlight:
+		return false, ErrMessageInFlight
+	}
+
+	if err = handler(ctx); err != nil {
+		if releaseErr := store.release(ctx, id); releaseErr != nil {
+			logger.GetLogger().AddTraceInfoContextRequest(ctx).Err(releaseErr).Msg("msg idempotency release failed")
+		}
+		return false, err
+	}
+
+	if err = store.complete(ctx, id); err != nil {
+		// the event was handled: it is committed, and only a redelivery within the lease is skipped
+		logger.GetLogger().AddTraceInfoContextRequest(ctx).Err(err).Msg("msg idempotency complete failed")
+	}
+	return true, nil
+}
+
+// leaseTTL bounds the idempotency lease by the TTL of the processed IDs.
+func leaseTTL(ttl time.Duration) time.Duration {
+	if ttl < defaultIdempotencyLease {
+		return ttl
+	}
+	return defaultIdempotencyLease
+}
+
+type memoryEntry struct {
+	done     bool
+	expireAt time.Time
+}
+
+// MemoryIdempotencyStore keeps IDs in process for ttl. It only deduplicates redeliveries
+// to the same instance; shared stores are needed across instances.
+type MemoryIdempotencyStore struct {
+	ttl       time.Duration
+	ids       map[string]memoryEntry
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewMemoryIdempotencyStore(ttl time.Duration) *MemoryIdempotencyStore {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &MemoryIdempotencyStore{
+		ttl:       ttl,
+		ids:       make(map[string]memoryEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Process(ctx context.Context, id string, handler func(ctx context.Context) error) (bool, error) {
+	return processWithLease(ctx, s, id, handler)
+}
+
+func (s *MemoryIdempotencyStore) claim(ctx context.Context, id string) (claimStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.lastSweep) >= s.ttl {
+		for k, entry := range s.ids {
+			if now.After(entry.expireAt) {
+				delete(s.ids, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	if entry, ok := s.ids[id]; ok && now.Before(entry.expireAt) {
+		if entry.done {
+			return claimDone, nil
+		}
+		return claimInFlight, nil
+	}
+
+	s.ids[id] = memoryEntry{expireAt: now.Add(leaseTTL(s.ttl))}
+	return claimAcquired, nil
+}
+
+func (s *MemoryIdempotencyStore) complete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	s.ids[id] = memoryEntry{done: true, expireAt: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) release(ctx context.Context, id string) error {
+	s.mu.Lock()
+	delete(s.ids, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// RedisIdempotencyStore leases IDs with SETNX, then records them as processed for ttl.
+type RedisIdempotencyStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewRedisIdempotencyStore(client *redis.Client, ttl time.Duration) *RedisIdempotencyStore {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &RedisIdempotencyStore{client: client, ttl: ttl}
+}
+
+func (s *RedisIdempotencyStore) Process(ctx context.Context, id string, handler func(ctx context.Context) error) (bool, error) {
+	return processWithLease(ctx, s, id, handler)
+}
+
+func (s *RedisIdempotencyStore) claim(ctx context.Context, id string) (claimStatus, error) {
+	acquired, err := s.client.AcquireLock(ctx, KeyProcessedMessage+id, leaseTTL(s.ttl))
+	if err != nil {
+		return 0, err
+	}
+	if acquired {
+		return claimAcquired, nil
+	}
+
+	value, err := s.client.GetString(ctx, KeyProcessedMessage+id)
+	if err != nil {
+		return 0, err
+	}
+	if value == processedValue {
+		return claimDone, nil
+	}
+	return claimInFlight, nil
+}
+
+func (s *RedisIdempotencyStore) complete(ctx context.Context, id string) error {
+	return s.client.SetString(ctx, KeyProcessedMessage+id, processedValue, s.ttl)
+}
+
+func (s *RedisIdempotencyStore) release(ctx context.Context, id string) error {
+	return s.client.ReleaseLock(ctx, KeyProcessedMessage+id)
+}
+
+type ProcessedMessage struct {
+	MessageID string    `bson:"message_id"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+func (ProcessedMessage) CollectionName() string {
+	return ColProcessedMessage
+}
+
+func (ProcessedMessage) IndexModels() []mongo.IndexModel {
+	return []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "message_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "created_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(defaultIdempotencyTTL.Seconds())),
+		},
+	}
+}
+
+// MongoIdempotencyStore records IDs in the processed_message collection, whose unique index
+// rejects duplicates. Documents expire after a day.
+type MongoIdempotencyStore struct {
+	storage *mongodb.DatabaseStorage
+	repo    *mongodb.Repository[ProcessedMessage]
+}
+
+func NewMongoIdempotencyStore(storage *mongodb.DatabaseStorage) *MongoIdempotencyStore {
+	return &MongoIdempotencyStore{
+		storage: storage,
+		repo:    mongodb.NewRepository[ProcessedMessage](storage, nil),
+	}
+}
+
+// Process records id in the transaction of handler, so that the mark and the handler's writes
+// commit together. Handler must pass the context it receives to its writes for them to join
+// the transaction.
+func (s *MongoIdempotencyStore) Process(ctx context.Context, id string, handler func(ctx context.Context) error) (bool, error) {
+	err := s.storage.ExecTransaction(ctx, func(sessCtx mongo.SessionContext) (interface{}, error) {
+		_, err := s.repo.InsertOne(sessCtx, ProcessedMessage{MessageID: id, CreatedAt: time.Now()})
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errDuplicateMessage
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, handler(sessCtx)
+	})
+
+	if errors.Is(err, errDuplicateMessage) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,107 @@
+package msg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	logger "go-source/pkg/log"
+	"go-source/pkg/metric"
+)
+
+var ErrHandlerPanic = errors.New("event handler panicked")
+
+// Logging logs every handled event with its duration and error.
+func Logging(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, event Event) error {
+		start := time.Now()
+		err := next(ctx, event)
+
+		log := logger.GetLogger().AddTraceInfoContextRequest(ctx)
+		logEvent := log.Info()
+		if err != nil {
+			logEvent = log.Error().Err(err)
+		}
+		logEvent.
+			Str("event_type", event.Type).
+			Str("event_id", event.ID).
+			Dur("duration", time.Since(start)).
+			Msg("msg event handled")
+
+		return err
+	}
+}
+
+// Metrics records the handling duration per event type and result.
+func Metrics(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, event Event) error {
+		start := time.Now()
+		err := next(ctx, event)
+
+		code := "SUCCESS"
+		if err != nil {
+			code = metric.DefaultErr.Error()
+		}
+		metric.NewMsgHandlerHistogramDuration(event.Type, code, time.Since(start))
+
+		return err
+	}
+}
+
+// Recover turns a panic of the handler into an ErrHandlerPanic error, so the message goes
+// through the consumer's retry policy instead of crashing the service.
+func Recover(next HandlerFunc) HandlerFunc {
+	return func(ctx context.Context, event Event) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.GetLogger().AddTraceInfoContextRequest(ctx).Error().
+					Str("event_type", event.Type).
+					Str("stack", string(debug.Stack())).
+					Msgf("msg handler panic: %v", r)
+				err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+			}
+		}()
+
+		return next(ctx, event)
+	}
+}
+
+// Idempotency skips and counts events whose message ID was already processed, as recorded in
+// store. An ID is recorded once the handler succeeded; with a MongoIdempotencyStore the record
+// and the handler's writes commit together.
+func Idempotency(store IdempotencyStore, opts ...IdempotencyOption) Middleware {
+	cfg := idempotencyConfig{messageID: IDFromOffset}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, event Event) error {
+			id := cfg.messageID(event)
+			if id == "" {
+				return next(ctx, event)
+			}
+
+			processed, err := store.Process(ctx, id, func(ctx context.Context) error {
+				return next(ctx, event)
+			})
+			if err != nil {
+				return err
+			}
+			if !processed {
+				onDuplicate(ctx, event, id)
+			}
+			return nil
+		}
+	}
+}
+
+func onDuplicate(ctx context.Context, event Event, id string) {
+	metric.RecordMsgDuplicate(event.Type)
+	logger.GetLogger().AddTraceInfoContextRequest(ctx).Info().
+		Str("event_type", event.Type).
+		Str("message_id", id).
+		Msg("msg duplicate event skipped")
+}
@@ -0,0 +1,81 @@
+package msg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	logger "go-source/pkg/log"
+)
+
+func TestIdempotency_SkipsDuplicates(t *testing.T) {
+	logger.InitLog("msg-test")
+
+	calls := 0
+	fail := true
+	handler := Idempotency(NewMemoryIdempotencyStore(0), WithMessageID(IDFromHeader(HeaderMessageID)))(
+		func(ctx context.Context, event Event) error {
+			calls++
+			if fail {
+				return errors.New("failed")
+			}
+			return nil
+		},
+	)
+
+	ctx := context.Background()
+	first := Event{ID: "orders/0/1", Headers: map[string]string{HeaderMessageID: "m-1"}}
+	// republished to a retry topic: new offset, same message ID
+	retried := Event{ID: "orders.retry.1/0/7", Headers: map[string]string{HeaderMessageID: "m-1"}}
+
+	if err := handler(ctx, first); err == nil {
+		t.Fatal("handler() error = nil, want the handler error")
+	}
+
+	fail = false
+	if err := handler(ctx, retried); err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if err := handler(ctx, first); err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+
+	if calls != 2 {
+		t.Fatalf("calls = %d, want 2: the failed claim is released and the duplicate skipped", calls)
+	}
+}
+
+func TestIdempotency_LeasesInFlightMessages(t *testing.T) {
+	logger.InitLog("msg-test")
+
+	store := NewMemoryIdempotencyStore(0)
+	event := Event{ID: "orders/0/1"}
+
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := Idempotency(store)(func(ctx context.Context, event Event) error {
+		close(started)
+		<-finish
+		return nil
+	})
+
+	done := make(chan error, 1)
+	go func() { done <- handler(context.Background(), event) }()
+	<-started
+
+	// a redelivery while the first handler runs is not committed as a duplicate
+	redelivered := Idempotency(store)(func(ctx context.Context, event Event) error {
+		t.Fatal("handler called while the message is in flight")
+		return nil
+	})
+	if err := redelivered(context.Background(), event); !errors.Is(err, ErrMessageInFlight) {
+		t.Fatalf("handler() error = %v, want ErrMessageInFlight", err)
+	}
+
+	close(finish)
+	if err := <-done; err != nil {
+		t.Fatalf("handler() error = %v", err)
+	}
+	if err := redelivered(context.Background(), event); err != nil {
+		t.Fatalf("handler() error = %v, want the duplicate skipped", err)
+	}
+}
@@ -0,0 +1,128 @@
+package msg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	logger "go-source/pkg/log"
+	"go-source/pkg/queue/kafka"
+)
+
+var (
+	ErrInvalidEnvelope = errors.New("invalid event envelope")
+	ErrInvalidPayload  = errors.New("invalid event payload")
+)
+
+// Event is a consumed models.ConsumerMessage with its payload left undecoded.
+type Event struct {
+	// ID identifies the message for idempotency: "<topic>/<partition>/<offset>".
+	ID        string
+	Type      string
+	Key       []byte
+	Data      json.RawMessage
+	Headers   map[string]string
+	Topic     string
+	Partition int32
+	Offset    int64
+	Timestamp time.Time
+}
+
+type HandlerFunc func(ctx context.Context, event Event) error
+
+// Middleware wraps a HandlerFunc, the same way echo middlewares wrap echo handlers.
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// envelope is models.ConsumerMessage with a raw payload, so that handlers decode it into their own type.
+type envelope struct {
+	EventType string          `json:"eventType"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Router dispatches consumed messages to the handler registered for their event type.
+type Router struct {
+	handlers    map[string]HandlerFunc
+	middlewares []Middleware
+	mu          sync.RWMutex
+}
+
+func NewRouter() *Router {
+	return &Router{
+		handlers: make(map[string]HandlerFunc),
+	}
+}
+
+// Use appends middlewares to the chain. The first one is the outermost.
+func (r *Router) Use(middlewares ...Middleware) {
+	r.mu.Lock()
+	r.middlewares = append(r.middlewares, middlewares...)
+	r.mu.Unlock()
+}
+
+// Register sets the handler of eventType, replacing the previous one.
+func (r *Router) Register(eventType string, handler HandlerFunc) {
+	r.mu.Lock()
+	r.handlers[eventType] = handler
+	r.mu.Unlock()
+}
+
+// Handle registers a handler receiving the payload of eventType decoded into T.
+func Handle[T any](r *Router, eventType string, handler func(ctx context.Context, event Event, payload T) error) {
+	r.Register(eventType, func(ctx context.Context, event Event) error {
+		var payload T
+		if len(event.Data) > 0 {
+			if err := json.Unmarshal(event.Data, &payload); err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidPayload, event.Type, err)
+			}
+		}
+		return handler(ctx, event, payload)
+	})
+}
+
+// Dispatch is the kafka.OnEventHandler of the consumers owned by the server. Events without
+// a registered handler are logged and skipped, so that their offsets are committed.
+func (r *Router) Dispatch(ctx context.Context, key, value []byte) error {
+	var env envelope
+	if err := json.Unmarshal(value, &env); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidEnvelope, err)
+	}
+
+	event := Event{
+		Type: env.EventType,
+		Key:  key,
+		Data: env.Data,
+	}
+	if msg, ok := kafka.MessageFromContext(ctx); ok {
+		event.ID = fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+		event.Topic = msg.Topic
+		event.Partition = msg.Partition
+		event.Offset = msg.Offset
+		event.Timestamp = msg.Timestamp
+		event.Headers = make(map[string]string, len(msg.Headers))
+		for _, h := range msg.Headers {
+			event.Headers[h.Key] = string(h.Value)
+		}
+	}
+
+	r.mu.RLock()
+	handler, ok := r.handlers[event.Type]
+	middlewares := r.middlewares
+	r.mu.RUnlock()
+
+	if !ok {
+		logger.GetLogger().AddTraceInfoContextRequest(ctx).Warn().
+			Str("event_type", event.Type).
+			Str("topic", event.Topic).
+			Msg("msg no handler for event type")
+		return nil
+	}
+
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+
+	return handler(ctx, event)
+}
@@ -0,0 +1,50 @@
+package msg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	logger "go-source/pkg/log"
+)
+
+type userCreated struct {
+	UserID string `json:"userId"`
+}
+
+func TestRouter_Dispatch(t *testing.T) {
+	logger.InitLog("msg-test")
+
+	r := NewRouter()
+	r.Use(Recover)
+
+	var got userCreated
+	Handle(r, "user.created", func(ctx context.Context, event Event, payload userCreated) error {
+		got = payload
+		return nil
+	})
+	r.Register("user.deleted", func(ctx context.Context, event Event) error {
+		panic("boom")
+	})
+
+	ctx := context.Background()
+	if err := r.Dispatch(ctx, nil, []byte(`{"eventType":"user.created","data":{"userId":"u-1"}}`)); err != nil {
+		t.Fatalf("Dispatch() error = %v", err)
+	}
+	if got.UserID != "u-1" {
+		t.Fatalf("payload = %+v, want userId u-1", got)
+	}
+
+	if err := r.Dispatch(ctx, nil, []byte(`{"eventType":"user.created","data":"u-1"}`)); !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("Dispatch() error = %v, want ErrInvalidPayload", err)
+	}
+	if err := r.Dispatch(ctx, nil, []byte(`{"eventType":"user.deleted"}`)); !errors.Is(err, ErrHandlerPanic) {
+		t.Fatalf("Dispatch() error = %v, want ErrHandlerPanic", err)
+	}
+	if err := r.Dispatch(ctx, nil, []byte(`{"eventType":"unknown"}`)); err != nil {
+		t.Fatalf("Dispatch() error = %v, want nil for unknown event type", err)
+	}
+	if err := r.Dispatch(ctx, nil, []byte(`not json`)); !errors.Is(err, ErrInvalidEnvelope) {
+		t.Fatalf("Dispatch() error = %v, want ErrInvalidEnvelope", err)
+	}
+}
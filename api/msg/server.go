@@ -1,3 +1,84 @@
 package msg
 
-// TODO: Add your code here
+import (
+	"context"
+	"sync"
+
+	"go-source/bootstrap"
+	logger "go-source/pkg/log"
+	"go-source/pkg/queue/kafka"
+)
+
+// Server consumes events from kafka and routes them by event type to the registered handlers.
+type Server struct {
+	handlers  *bootstrap.Handlers
+	router    *Router
+	consumers []*kafka.Consumer
+	wg        sync.WaitGroup
+}
+
+// NewServer creates a server skipping events already recorded in store, identified by their
+// HeaderMessageID header or, without one, their offset.
+func NewServer(handlers *bootstrap.Handlers, store IdempotencyStore, consumers ...*kafka.Consumer) *Server {
+	router := NewRouter()
+	router.Use(Recover, Logging, Metrics, Idempotency(store, WithMessageID(IDFromHeader(HeaderMessageID))))
+
+	return &Server{
+		handlers:  handlers,
+		router:    router,
+		consumers: consumers,
+	}
+}
+
+// Router returns the router of the server, to register handlers or middlewares before Start.
+func (s *Server) Router() *Router {
+	return s.router
+}
+
+// Start registers the event handlers and starts every consumer. It does not block; the
+// consumers stop when ctx is cancelled or Stop is called.
+func (s *Server) Start(ctx context.Context) {
+	s.registerHandlers()
+
+	for _, consumer := range s.consumers {
+		consumer.OnEvent(s.router.Dispatch)
+
+		s.wg.Add(1)
+		go func(consumer *kafka.Consumer) {
+			defer s.wg.Done()
+			if err := consumer.Start(ctx); err != nil {
+				logger.GetLogger().Error().Err(err).Msgf("msg consumer failed: TOPIC = %v", consumer.GetTopics())
+			}
+		}(consumer)
+	}
+
+	logger.GetLogger().Info().Msgf("msg server started with %d consumers", len(s.consumers))
+}
+
+// Stop shuts the consumers down and waits for them to commit their offsets, or until ctx is done.
+func (s *Server) Stop(ctx context.Context) {
+	logger.GetLogger().Info().Msg("Stopping msg server...")
+
+	for _, consumer := range s.consumers {
+		go consumer.Shutdown(ctx)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.GetLogger().Warn().Msg("msg server force shutdown")
+	case <-done:
+		logger.GetLogger().Info().Msg("msg server stopped gracefully")
+	}
+}
+
+// registerHandlers registers the handlers of every event type, e.g.
+//
+//	Handle(s.router, "user.created", func(ctx context.Context, event Event, payload models.UserCreated) error {...})
+func (s *Server) registerHandlers() {
+}
@@ -11,6 +11,7 @@ import (
 
 	"go-source/api/grpc"
 	"go-source/api/http"
+	"go-source/api/msg"
 	"go-source/api/ws"
 	"go-source/bootstrap"
 	"go-source/config"
@@ -18,6 +19,8 @@ import (
 	"go-source/pkg/constant"
 	"go-source/pkg/database/redis"
 	logger "go-source/pkg/log"
+	"go-source/pkg/middlewares"
+	"go-source/pkg/queue/kafka"
 )
 
 // @title Social Service API
@@ -63,6 +66,9 @@ func main() {
 		log.Fatal().Msgf("Connect redis failed: %s", err)
 	}
 
+	// Initialize rate limiter with local fallback when Redis is unavailable
+	middlewares.InitRateLimiter(config.RateLimitConfig)
+
 	// Initialize application dependencies following clean architecture pattern
 	storage := bootstrap.NewDatabaseConnection(ctx)
 	clients := bootstrap.NewClients()
@@ -90,7 +96,15 @@ func main() {
 		}
 	}()
 
-	log.Info().Msg("HTTP, WebSocket, and gRPC servers started successfully")
+	// Start msg server consuming events from kafka
+	var msgServer *msg.Server
+	if len(config.MsgTopics) > 0 {
+		store := msg.NewRedisIdempotencyStore(redisClient, 0)
+		msgServer = msg.NewServer(handlers, store, kafka.NewConsumer(config.KafkaConfig, config.MsgTopics))
+		msgServer.Start(ctx)
+	}
+
+	log.Info().Msg("HTTP, WebSocket, gRPC, and msg servers started successfully")
 
 	// Wait for termination signal for graceful shutdown
 	<-ctx.Done()
@@ -101,6 +115,11 @@ func main() {
 	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer shutdownCancel()
 
+	// Stop msg server first so that in-flight events finish while their dependencies are up
+	if msgServer != nil {
+		msgServer.Stop(shutdownCtx)
+	}
+
 	// Stop gRPC server
 	grpcServer.Stop()
 
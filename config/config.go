@@ -3,6 +3,8 @@ package config
 import (
 	"go-source/pkg/database/mongodb"
 	"go-source/pkg/database/redis"
+	"go-source/pkg/middlewares"
+	"go-source/pkg/queue/kafka"
 
 	"github.com/caarlos0/env/v7"
 )
@@ -16,6 +18,12 @@ type SystemConfig struct {
 
 	MongoDBConfig mongodb.MongoDBConfig `envPrefix:"MONGO_DB_" envSeparator:"_"`
 	RedisConfig   redis.RedisConfig     `envPrefix:"REDIS_" envSeparator:"_"`
+
+	RateLimitConfig middlewares.RateLimitConfig `envPrefix:"RATE_LIMIT_" envSeparator:"_"`
+
+	KafkaConfig kafka.KafkaConfig `envPrefix:"KAFKA_" envSeparator:"_"`
+	// MsgTopics are consumed by the msg server, which is not started when it is empty.
+	MsgTopics []string `env:"MSG_TOPICS" envSeparator:","`
 }
 
 var configSingletonObj *SystemConfig
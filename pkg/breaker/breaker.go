@@ -0,0 +1,218 @@
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOpen            = errors.New("circuit breaker is open")
+	ErrTooManyRequests = errors.New("circuit breaker is half-open: too many requests")
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+const (
+	defaultFailureThreshold    = 5
+	defaultOpenTimeout         = 10 * time.Second
+	defaultHalfOpenMaxRequests = 1
+	defaultSuccessThreshold    = 1
+)
+
+type Config struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker.
+	FailureThreshold int `env:"FAILURE_THRESHOLD"`
+	// OpenTimeout is how long the breaker stays open before letting probe requests through.
+	OpenTimeout time.Duration `env:"OPEN_TIMEOUT"`
+	// HalfOpenMaxRequests is the number of concurrent probes allowed while half-open.
+	HalfOpenMaxRequests int `env:"HALF_OPEN_MAX_REQUESTS"`
+	// SuccessThreshold is the number of successful probes that closes the breaker again.
+	SuccessThreshold int `env:"SUCCESS_THRESHOLD"`
+}
+
+type OnStateChangeFunc func(name string, from, to State)
+
+type Option func(b *Breaker)
+
+// WithOnStateChange registers a callback invoked (outside the breaker lock) on every state transition.
+func WithOnStateChange(fn OnStateChangeFunc) Option {
+	return func(b *Breaker) {
+		b.onStateChange = fn
+	}
+}
+
+// Breaker is a consecutive-failure circuit breaker with closed, open and half-open states.
+type Breaker struct {
+	name          string
+	cfg           Config
+	onStateChange OnStateChangeFunc
+	now           func() time.Time
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	successes int
+	inFlight  int
+	openedAt  time.Time
+}
+
+func New(name string, cfg Config, opts ...Option) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultFailureThreshold
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = defaultOpenTimeout
+	}
+	if cfg.HalfOpenMaxRequests <= 0 {
+		cfg.HalfOpenMaxRequests = defaultHalfOpenMaxRequests
+	}
+	if cfg.SuccessThreshold <= 0 {
+		cfg.SuccessThreshold = defaultSuccessThreshold
+	}
+
+	b := &Breaker{
+		name: name,
+		cfg:  cfg,
+		now:  time.Now,
+	}
+
+	for _, o := range opts {
+		o(b)
+	}
+
+	return b
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	state, from, changed := b.currentState()
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(from, state)
+	}
+	return state
+}
+
+// Allow reports whether a call may proceed. Every nil return must be followed by exactly one Done call.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	state, from, changed := b.currentState()
+
+	var err error
+	switch state {
+	case StateOpen:
+		err = ErrOpen
+	case StateHalfOpen:
+		if b.inFlight >= b.cfg.HalfOpenMaxRequests {
+			err = ErrTooManyRequests
+		} else {
+			b.inFlight++
+		}
+	}
+	b.mu.Unlock()
+
+	if changed {
+		b.notify(from, state)
+	}
+
+	return err
+}
+
+// Done records the outcome of a call previously admitted by Allow.
+func (b *Breaker) Done(err error) {
+	b.mu.Lock()
+	from := b.state
+	to := from
+
+	switch b.state {
+	case StateClosed:
+		if err == nil {
+			b.failures = 0
+		} else {
+			b.failures++
+			if b.failures >= b.cfg.FailureThreshold {
+				to = b.setState(StateOpen)
+			}
+		}
+
+	case StateHalfOpen:
+		if b.inFlight > 0 {
+			b.inFlight--
+		}
+		if err == nil {
+			b.successes++
+			if b.successes >= b.cfg.SuccessThreshold {
+				to = b.setState(StateClosed)
+			}
+		} else {
+			to = b.setState(StateOpen)
+		}
+	}
+	b.mu.Unlock()
+
+	if from != to {
+		b.notify(from, to)
+	}
+}
+
+// Execute runs fn if the breaker allows it and records its result.
+func (b *Breaker) Execute(fn func() error) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+
+	err := fn()
+	b.Done(err)
+	return err
+}
+
+// currentState moves an expired open breaker to half-open. Callers must hold mu.
+func (b *Breaker) currentState() (state State, from State, changed bool) {
+	from = b.state
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.setState(StateHalfOpen)
+	}
+	return b.state, from, from != b.state
+}
+
+func (b *Breaker) setState(state State) State {
+	b.state = state
+	b.failures = 0
+	b.successes = 0
+	b.inFlight = 0
+	if state == StateOpen {
+		b.openedAt = b.now()
+	}
+	return state
+}
+
+func (b *Breaker) notify(from, to State) {
+	if b.onStateChange != nil {
+		b.onStateChange(b.name, from, to)
+	}
+}
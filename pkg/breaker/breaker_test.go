@@ -0,0 +1,40 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker_StateTransitions(t *testing.T) {
+	now := time.Now()
+	b := New("test", Config{FailureThreshold: 2, OpenTimeout: time.Second})
+	b.now = func() time.Time { return now }
+
+	errFailed := errors.New("failed")
+	for i := 0; i < 2; i++ {
+		if err := b.Execute(func() error { return errFailed }); !errors.Is(err, errFailed) {
+			t.Fatalf("Execute() error = %v, want %v", err, errFailed)
+		}
+	}
+
+	if got := b.State(); got != StateOpen {
+		t.Fatalf("State() = %v, want %v", got, StateOpen)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Allow() error = %v, want %v", err, ErrOpen)
+	}
+
+	now = now.Add(time.Second)
+	if err := b.Allow(); err != nil {
+		t.Fatalf("Allow() error = %v, want nil", err)
+	}
+	if err := b.Allow(); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("Allow() error = %v, want %v", err, ErrTooManyRequests)
+	}
+
+	b.Done(nil)
+	if got := b.State(); got != StateClosed {
+		t.Fatalf("State() = %v, want %v", got, StateClosed)
+	}
+}
@@ -0,0 +1,399 @@
+package client
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"go-source/pkg/jwt"
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+)
+
+const (
+	HeaderAPIKey        = "X-API-Key"
+	HeaderSignatureTime = "X-Signature-Timestamp"
+)
+
+const (
+	defaultEarlyRefresh  = 30 * time.Second
+	defaultServiceJWTTTL = 5 * time.Minute
+	defaultOAuth2Timeout = 10 * time.Second
+	defaultOAuth2Expire  = time.Hour
+
+	// keyAuthRetried marks the requests already retried after a 401
+	keyAuthRetried = "rest_auth_retried"
+)
+
+var ErrAuthToken = errors.New("http client get auth token failed")
+
+// AuthProvider sets the credentials of the requests of a client. Authenticate is a
+// RequestMiddlewareFunc; set by WithAuth, the provider runs after the other request
+// middlewares and a request answered 401 is sent once more after Invalidate.
+type AuthProvider interface {
+	Authenticate(client *resty.Client, request *resty.Request) error
+	// Invalidate drops the cached credentials, so that the next request gets new ones.
+	Invalidate()
+}
+
+// retryUnauthorized reports whether a 401 response is retried with new credentials, once per request.
+func retryUnauthorized(auth AuthProvider, response *resty.Response) bool {
+	if auth == nil || response == nil || response.StatusCode() != http.StatusUnauthorized {
+		return false
+	}
+
+	ctx := response.Request.Context()
+	if retried, _ := ctx.Value(keyAuthRetried).(bool); retried {
+		return false
+	}
+	response.Request.SetContext(context.WithValue(ctx, keyAuthRetried, true))
+
+	logger.GetLogger().AddTraceInfoContextRequest(ctx).Warn().
+		Str("url", response.Request.URL).
+		Msg("rest api unauthorized, retrying with new credentials")
+	auth.Invalidate()
+
+	return true
+}
+
+// cachedToken is a token reused until EarlyRefresh before it expires. In that window, one
+// caller fetches the next token in the background while the others keep the current one.
+type cachedToken struct {
+	fetch        func(ctx context.Context) (string, time.Time, error)
+	earlyRefresh time.Duration
+
+	token      string
+	expiresAt  time.Time
+	refreshing bool
+	mu         sync.Mutex
+	fetchMu    sync.Mutex
+}
+
+func (t *cachedToken) get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	now := time.Now()
+	switch {
+	case t.token != "" && now.Before(t.expiresAt.Add(-t.earlyRefresh)):
+		token := t.token
+		t.mu.Unlock()
+		return token, nil
+	case t.token != "" && now.Before(t.expiresAt):
+		token := t.token
+		if !t.refreshing {
+			t.refreshing = true
+			go func() {
+				_, _ = t.refresh(context.WithoutCancel(ctx))
+			}()
+		}
+		t.mu.Unlock()
+		return token, nil
+	}
+	t.mu.Unlock()
+
+	return t.refresh(ctx)
+}
+
+// refresh fetches a token, unless another caller just did.
+func (t *cachedToken) refresh(ctx context.Context) (string, error) {
+	t.fetchMu.Lock()
+	defer t.fetchMu.Unlock()
+
+	t.mu.Lock()
+	if t.token != "" && !t.refreshing && time.Now().Before(t.expiresAt.Add(-t.earlyRefresh)) {
+		token := t.token
+		t.mu.Unlock()
+		return token, nil
+	}
+	t.mu.Unlock()
+
+	token, expiresAt, err := t.fetch(ctx)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.refreshing = false
+	if err != nil {
+		logger.GetLogger().AddTraceInfoContextRequest(ctx).Err(err).Msg("http client auth token refresh failed")
+		return "", err
+	}
+	t.token, t.expiresAt = token, expiresAt
+
+	return token, nil
+}
+
+func (t *cachedToken) invalidate() {
+	t.mu.Lock()
+	t.token = ""
+	t.mu.Unlock()
+}
+
+// OAuth2Config configures the OAuth2 client credentials grant.
+type OAuth2Config struct {
+	TokenURL     string        `env:"TOKEN_URL"`
+	ClientID     string        `env:"CLIENT_ID"`
+	ClientSecret string        `env:"CLIENT_SECRET"`
+	Scopes       []string      `env:"SCOPES" envSeparator:","`
+	Audience     string        `env:"AUDIENCE"`
+	EarlyRefresh time.Duration `env:"EARLY_REFRESH" envDefault:"30s"`
+	Timeout      time.Duration `env:"TIMEOUT" envDefault:"10s"`
+}
+
+// OAuth2Auth sends a bearer token obtained with the client credentials grant.
+type OAuth2Auth struct {
+	cfg    OAuth2Config
+	client *resty.Client
+	token  *cachedToken
+}
+
+func NewOAuth2Auth(cfg OAuth2Config) *OAuth2Auth {
+	if cfg.EarlyRefresh <= 0 {
+		cfg.EarlyRefresh = defaultEarlyRefresh
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultOAuth2Timeout
+	}
+
+	a := &OAuth2Auth{
+		cfg: cfg,
+		// the token endpoint is called without the logs of Client, which would show the secrets
+		client: resty.New().SetTimeout(cfg.Timeout).SetLogger(NoOpLogger{}),
+	}
+	a.token = &cachedToken{fetch: a.fetch, earlyRefresh: cfg.EarlyRefresh}
+
+	return a
+}
+
+func (a *OAuth2Auth) Authenticate(client *resty.Client, request *resty.Request) error {
+	token, err := a.token.get(request.Context())
+	if err != nil {
+		return err
+	}
+
+	request.SetAuthToken(token)
+	return nil
+}
+
+func (a *OAuth2Auth) Invalidate() {
+	a.token.invalidate()
+}
+
+type oauth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (a *OAuth2Auth) fetch(ctx context.Context) (string, time.Time, error) {
+	form := map[string]string{"grant_type": "client_credentials"}
+	if len(a.cfg.Scopes) > 0 {
+		form["scope"] = strings.Join(a.cfg.Scopes, " ")
+	}
+	if a.cfg.Audience != "" {
+		form["audience"] = a.cfg.Audience
+	}
+
+	res, err := a.client.R().
+		SetContext(ctx).
+		SetBasicAuth(neturl.QueryEscape(a.cfg.ClientID), neturl.QueryEscape(a.cfg.ClientSecret)).
+		SetFormData(form).
+		Post(a.cfg.TokenURL)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%w: %v", ErrAuthToken, err)
+	}
+	if res.StatusCode() != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("%w: status_code: %d", ErrAuthToken, res.StatusCode())
+	}
+
+	var result oauth2TokenResponse
+	if err = json.Unmarshal(res.Body(), &result); err != nil || result.AccessToken == "" {
+		return "", time.Time{}, fmt.Errorf("%w: no access_token in response", ErrAuthToken)
+	}
+
+	expiresIn := time.Duration(result.ExpiresIn) * time.Second
+	if expiresIn <= 0 {
+		// without expires_in, the token is kept until a 401 invalidates it
+		expiresIn = defaultOAuth2Expire
+	}
+
+	return result.AccessToken, time.Now().Add(expiresIn), nil
+}
+
+// ServiceJWTConfig sets the claims of the service tokens.
+type ServiceJWTConfig struct {
+	Issuer   string
+	Subject  string
+	Audience string
+	// TTL defaults to the expire of the JWT config, or 5 minutes.
+	TTL          time.Duration
+	EarlyRefresh time.Duration
+}
+
+// ServiceJWTAuth sends a bearer token signed by the service itself.
+type ServiceJWTAuth struct {
+	jwt   *jwt.JWT
+	cfg   ServiceJWTConfig
+	token *cachedToken
+}
+
+func NewServiceJWTAuth(j *jwt.JWT, cfg ServiceJWTConfig) *ServiceJWTAuth {
+	if cfg.TTL <= 0 {
+		cfg.TTL = j.GetExpire()
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultServiceJWTTTL
+	}
+	if cfg.EarlyRefresh <= 0 || cfg.EarlyRefresh >= cfg.TTL {
+		cfg.EarlyRefresh = cfg.TTL / 5
+	}
+
+	a := &ServiceJWTAuth{jwt: j, cfg: cfg}
+	a.token = &cachedToken{fetch: a.sign, earlyRefresh: cfg.EarlyRefresh}
+
+	return a
+}
+
+func (a *ServiceJWTAuth) Authenticate(client *resty.Client, request *resty.Request) error {
+	token, err := a.token.get(request.Context())
+	if err != nil {
+		return err
+	}
+
+	request.SetAuthToken(token)
+	return nil
+}
+
+func (a *ServiceJWTAuth) Invalidate() {
+	a.token.invalidate()
+}
+
+func (a *ServiceJWTAuth) sign(ctx context.Context) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(a.cfg.TTL)
+
+	claims := map[string]interface{}{
+		"iat":        now.Unix(),
+		"nbf":        now.Unix(),
+		utils.JwtExp: expiresAt.Unix(),
+		"jti":        utils.GenerateID(),
+	}
+	if a.cfg.Issuer != "" {
+		claims["iss"] = a.cfg.Issuer
+	}
+	if a.cfg.Subject != "" {
+		claims[utils.JwtSub] = a.cfg.Subject
+	}
+	if a.cfg.Audience != "" {
+		claims["aud"] = a.cfg.Audience
+	}
+
+	token, err := a.jwt.SignToken(claims)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("%w: %v", ErrAuthToken, err)
+	}
+
+	return token, expiresAt, nil
+}
+
+// HMACAuth signs the requests with a shared secret. The signature header (utils.KeySignature)
+// holds the hex HMAC-SHA256 of the lines:
+//
+//	method
+//	path
+//	sorted query
+//	unix timestamp, also sent in X-Signature-Timestamp
+//	hex SHA-256 of the body
+type HMACAuth struct {
+	secret []byte
+}
+
+func NewHMACAuth(secret string) *HMACAuth {
+	return &HMACAuth{secret: []byte(secret)}
+}
+
+func (a *HMACAuth) Authenticate(client *resty.Client, request *resty.Request) error {
+	body, err := requestBodyBytes(request.Body)
+	if err != nil {
+		return err
+	}
+	// the signed bytes are sent as they are
+	if request.Body != nil {
+		request.SetBody(body)
+		if request.Header.Get("Content-Type") == "" {
+			request.SetHeader("Content-Type", "application/json")
+		}
+	}
+
+	u, err := neturl.Parse(request.URL)
+	if err != nil {
+		return err
+	}
+	if !u.IsAbs() {
+		if u, err = neturl.Parse(strings.TrimRight(client.BaseURL, "/") + "/" + strings.TrimLeft(request.URL, "/")); err != nil {
+			return err
+		}
+	}
+	query := u.Query()
+	for k, v := range request.QueryParam {
+		query[k] = append(query[k], v...)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.SetHeader(HeaderSignatureTime, timestamp)
+	request.SetHeader(utils.KeySignature, a.Sign(request.Method, u.EscapedPath(), query.Encode(), timestamp, body))
+
+	return nil
+}
+
+// Sign returns the signature of a request, for the services verifying it.
+func (a *HMACAuth) Sign(method, path, query, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(strings.Join([]string{method, path, query, timestamp, utils.Sha256HashHex(body)}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *HMACAuth) Invalidate() {}
+
+func requestBodyBytes(body interface{}) ([]byte, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		return b, nil
+	case string:
+		return []byte(b), nil
+	default:
+		return json.Marshal(b)
+	}
+}
+
+// APIKeyAuth sends a static API key.
+type APIKeyAuth struct {
+	header string
+	key    string
+}
+
+// NewAPIKeyAuth sends key in header, X-API-Key when empty.
+func NewAPIKeyAuth(header, key string) *APIKeyAuth {
+	if header == "" {
+		header = HeaderAPIKey
+	}
+	return &APIKeyAuth{header: header, key: key}
+}
+
+func (a *APIKeyAuth) Authenticate(client *resty.Client, request *resty.Request) error {
+	request.SetHeader(a.header, a.key)
+	return nil
+}
+
+func (a *APIKeyAuth) Invalidate() {}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+)
+
+func TestOAuth2AuthRefreshOnUnauthorized(t *testing.T) {
+	logger.InitLog("test")
+
+	var issued int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, _ := r.BasicAuth()
+		if id != "svc" || secret != "secret" || r.FormValue("grant_type") != "client_credentials" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "token-" + strconv.Itoa(int(n)),
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	// the first token is revoked
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	auth := NewOAuth2Auth(OAuth2Config{TokenURL: tokenServer.URL, ClientID: "svc", ClientSecret: "secret"})
+	c := NewClient(server.URL, WithTimeout(time.Second), WithAuth(auth))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.R().SetContext(context.Background()).Post("/"); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if n := atomic.LoadInt32(&issued); n != 2 {
+		t.Fatalf("issued %d tokens, want 2", n)
+	}
+}
+
+func TestHMACAuth(t *testing.T) {
+	logger.InitLog("test")
+
+	auth := NewHMACAuth("secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		want := auth.Sign(r.Method, r.URL.EscapedPath(), r.URL.Query().Encode(), r.Header.Get(HeaderSignatureTime), body)
+		if r.Header.Get(utils.KeySignature) != want {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL+"/api", WithTimeout(time.Second), WithAuth(auth))
+	_, err := c.R().
+		SetContext(context.Background()).
+		SetQueryParam("b", "2").
+		SetBody(map[string]string{"name": "<alice>"}).
+		Post("/users?a=1")
+	if err != nil {
+		t.Fatalf("signature rejected: %v", err)
+	}
+}
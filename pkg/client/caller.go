@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// ErrDecodeResponse is returned, wrapped, when a success body does not decode into the result type.
+var ErrDecodeResponse = errors.New("decode response body failed")
+
+// Caller sends a request and returns the response whatever its status. Transport errors, and
+// requests rejected by the client, are returned as errors. *Client implements it; tests can
+// use the fake of the clienttest package.
+type Caller interface {
+	Call(ctx context.Context, req Request) (*Response, error)
+}
+
+var _ Caller = (*Client)(nil)
+
+type Request struct {
+	Method string
+	// Path is joined to the base URL of the client.
+	Path   string
+	Query  neturl.Values
+	Header map[string]string
+	// Body is encoded as JSON, unless it is a string or []byte.
+	Body    interface{}
+	Options []RequestOption
+}
+
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// StatusError is returned by the helpers for the responses whose status is not 2xx. The
+// fields of the error envelope of the services (middlewares.Resp) are filled when the body
+// holds one. It wraps ErrStatusCode.
+type StatusError struct {
+	StatusCode int
+	// ErrorCode is the errorCode of the envelope, e.g. "4000" or "ErrDataInvalid".
+	ErrorCode   string
+	Message     string
+	Description string
+	Body        []byte
+}
+
+func (e *StatusError) Error() string {
+	if e.ErrorCode == "" {
+		return fmt.Sprintf("status_code: %d", e.StatusCode)
+	}
+	return fmt.Sprintf("status_code: %d, error_code: %s, message: %s, description: %s",
+		e.StatusCode, e.ErrorCode, e.Message, e.Description)
+}
+
+func (e *StatusError) Unwrap() error {
+	return ErrStatusCode
+}
+
+// errorEnvelope is the error body of the services, see middlewares.Resp.
+type errorEnvelope struct {
+	ErrorCode   json.RawMessage `json:"errorCode"`
+	Message     string          `json:"message"`
+	Description string          `json:"description"`
+}
+
+// Call implements Caller.
+func (c *Client) Call(ctx context.Context, req Request) (*Response, error) {
+	request := c.NewRequest(ctx, req.Options...).SetHeaders(req.Header)
+	if req.Query != nil {
+		request.SetQueryParamsFromValues(req.Query)
+	}
+	if req.Body != nil {
+		request.SetBody(req.Body)
+	}
+
+	res, err := request.Execute(req.Method, req.Path)
+	if err != nil && !errors.Is(err, ErrStatusCode) {
+		return nil, err
+	}
+
+	return &Response{
+		StatusCode: res.StatusCode(),
+		Header:     res.Header(),
+		Body:       res.Body(),
+	}, nil
+}
+
+// Do sends req and decodes a 2xx body into TRes. An empty body leaves TRes to its zero value.
+// Other statuses return a *StatusError.
+func Do[TRes any](ctx context.Context, c Caller, req Request) (TRes, error) {
+	var result TRes
+
+	res, err := c.Call(ctx, req)
+	if err != nil {
+		return result, err
+	}
+
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		return result, newStatusError(res)
+	}
+
+	if len(bytes.TrimSpace(res.Body)) == 0 {
+		return result, nil
+	}
+
+	switch r := any(&result).(type) {
+	case *[]byte:
+		*r = res.Body
+	case *string:
+		*r = string(res.Body)
+	default:
+		if err := json.Unmarshal(res.Body, &result); err != nil {
+			return result, fmt.Errorf("%w: %v", ErrDecodeResponse, err)
+		}
+	}
+
+	return result, nil
+}
+
+func Get[TRes any](ctx context.Context, c Caller, path string, query neturl.Values) (TRes, error) {
+	return Do[TRes](ctx, c, Request{Method: http.MethodGet, Path: path, Query: query})
+}
+
+func Post[TReq, TRes any](ctx context.Context, c Caller, path string, body TReq) (TRes, error) {
+	return Do[TRes](ctx, c, Request{Method: http.MethodPost, Path: path, Body: body})
+}
+
+func Put[TReq, TRes any](ctx context.Context, c Caller, path string, body TReq) (TRes, error) {
+	return Do[TRes](ctx, c, Request{Method: http.MethodPut, Path: path, Body: body})
+}
+
+func Delete[TRes any](ctx context.Context, c Caller, path string) (TRes, error) {
+	return Do[TRes](ctx, c, Request{Method: http.MethodDelete, Path: path})
+}
+
+func newStatusError(res *Response) *StatusError {
+	statusErr := &StatusError{
+		StatusCode: res.StatusCode,
+		Body:       res.Body,
+	}
+
+	var envelope errorEnvelope
+	if err := json.Unmarshal(res.Body, &envelope); err == nil {
+		statusErr.ErrorCode = strings.Trim(string(envelope.ErrorCode), `"`)
+		if statusErr.ErrorCode == "null" {
+			statusErr.ErrorCode = ""
+		}
+		statusErr.Message = envelope.Message
+		statusErr.Description = envelope.Description
+	}
+
+	return statusErr
+}
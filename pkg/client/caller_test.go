@@ -0,0 +1,69 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"go-source/pkg/client"
+	"go-source/pkg/client/clienttest"
+	logger "go-source/pkg/log"
+)
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestTypedHelpers(t *testing.T) {
+	logger.InitLog("test")
+
+	fake := clienttest.NewFake()
+	defer fake.Close()
+
+	fake.Reply(http.MethodGet, "/users/1", http.StatusOK, user{ID: "1", Name: "alice"})
+	fake.Reply(http.MethodPost, "/users", http.StatusCreated, user{ID: "2", Name: "bob"})
+	fake.ReplyError(http.MethodGet, "/users/3", http.StatusBadRequest, 1002, "Error", "id is invalid")
+	fake.ReplyError(http.MethodGet, "/users/4", http.StatusUnauthorized, "ErrIASAuthentication", "Error", "")
+
+	c := fake.Client()
+	ctx := context.Background()
+
+	got, err := client.Get[user](ctx, c, "/users/1", url.Values{"expand": {"roles"}})
+	if err != nil || got.Name != "alice" {
+		t.Fatalf("Get() = %+v, %v", got, err)
+	}
+
+	created, err := client.Post[user, user](ctx, c, "/users", user{Name: "bob"})
+	if err != nil || created.ID != "2" {
+		t.Fatalf("Post() = %+v, %v", created, err)
+	}
+
+	requests := fake.Requests()
+	if requests[0].Query != "expand=roles" || string(requests[1].Body) != `{"id":"","name":"bob"}` {
+		t.Fatalf("unexpected requests: %+v", requests)
+	}
+
+	tests := []struct {
+		path       string
+		statusCode int
+		errorCode  string
+	}{
+		{path: "/users/3", statusCode: http.StatusBadRequest, errorCode: "1002"},
+		{path: "/users/4", statusCode: http.StatusUnauthorized, errorCode: "ErrIASAuthentication"},
+		{path: "/unknown", statusCode: http.StatusNotFound, errorCode: "404"},
+	}
+	for _, tt := range tests {
+		_, err := client.Get[user](ctx, c, tt.path, nil)
+
+		var statusErr *client.StatusError
+		if !errors.As(err, &statusErr) || !errors.Is(err, client.ErrStatusCode) {
+			t.Fatalf("%s: expected a StatusError, got %v", tt.path, err)
+		}
+		if statusErr.StatusCode != tt.statusCode || statusErr.ErrorCode != tt.errorCode {
+			t.Fatalf("%s: got status %d code %q", tt.path, statusErr.StatusCode, statusErr.ErrorCode)
+		}
+	}
+}
@@ -0,0 +1,423 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/tidwall/gjson"
+	"github.com/tidwall/sjson"
+	"gopkg.in/yaml.v3"
+
+	"go-source/pkg/utils"
+)
+
+type CassetteMode int
+
+const (
+	// CassetteReplay answers the requests with the recorded interactions, offline.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord sends the requests and records the interactions, saved by Save.
+	CassetteRecord
+)
+
+const scrubbedValue = "******"
+
+var (
+	// ErrCassetteUnmatched is returned, wrapped, for a replayed request matching no interaction.
+	ErrCassetteUnmatched = errors.New("http client cassette has no matching interaction")
+	ErrCassetteFormat    = errors.New("http client cassette format must be .yaml, .yml or .json")
+)
+
+// defaultScrubbedHeaders hold credentials, or change on every request; they are never
+// written to the cassettes.
+var defaultScrubbedHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	HeaderAPIKey,
+	utils.KeySignature,
+	HeaderSignatureTime,
+	HeaderIdempotencyKey,
+	echo.HeaderXRequestID,
+	utils.HeaderTraceParent,
+	utils.HeaderTraceState,
+}
+
+// Interaction is a request and its response, as saved in a cassette.
+type Interaction struct {
+	Request  CassetteRequest  `json:"request" yaml:"request"`
+	Response CassetteResponse `json:"response" yaml:"response"`
+}
+
+type CassetteRequest struct {
+	Method string `json:"method" yaml:"method"`
+	// URL is the path and query of the request; the host is not recorded.
+	URL    string      `json:"url" yaml:"url"`
+	Header http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body   string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+type CassetteResponse struct {
+	StatusCode int         `json:"statusCode" yaml:"statusCode"`
+	Header     http.Header `json:"header,omitempty" yaml:"header,omitempty"`
+	Body       string      `json:"body,omitempty" yaml:"body,omitempty"`
+}
+
+// Matcher reports whether a replayed request, scrubbed like the recorded ones, matches a
+// recorded request.
+type Matcher func(req CassetteRequest, recorded CassetteRequest) bool
+
+func MatchMethod(req CassetteRequest, recorded CassetteRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL compares the paths and the queries, whatever the order of the params.
+func MatchURL(req CassetteRequest, recorded CassetteRequest) bool {
+	u1, err1 := neturl.Parse(req.URL)
+	u2, err2 := neturl.Parse(recorded.URL)
+	if err1 != nil || err2 != nil {
+		return req.URL == recorded.URL
+	}
+	return u1.Path == u2.Path && u1.Query().Encode() == u2.Query().Encode()
+}
+
+// MatchBody compares the bodies, as JSON values when both are JSON.
+func MatchBody(req CassetteRequest, recorded CassetteRequest) bool {
+	var v1, v2 interface{}
+	if json.Unmarshal([]byte(req.Body), &v1) == nil && json.Unmarshal([]byte(recorded.Body), &v2) == nil {
+		b1, _ := json.Marshal(v1)
+		b2, _ := json.Marshal(v2)
+		return bytes.Equal(b1, b2)
+	}
+	return req.Body == recorded.Body
+}
+
+type CassetteOption func(c *Cassette)
+
+// WithMatchers replaces the default matchers, MatchMethod and MatchURL.
+func WithMatchers(matchers ...Matcher) CassetteOption {
+	return func(c *Cassette) {
+		c.matchers = matchers
+	}
+}
+
+// WithScrubbedHeaders adds headers removed from the cassette, besides the credentials.
+func WithScrubbedHeaders(headers ...string) CassetteOption {
+	return func(c *Cassette) {
+		c.scrubbedHeaders = append(c.scrubbedHeaders, headers...)
+	}
+}
+
+// WithScrubbedFields adds body fields, as gjson paths, masked in the cassette besides the
+// SensitiveData fields and the encrypted fields of the client.
+func WithScrubbedFields(fields ...string) CassetteOption {
+	return func(c *Cassette) {
+		c.scrubbedFields = append(c.scrubbedFields, fields...)
+	}
+}
+
+// Cassette records the interactions of a client to a YAML or JSON file, chosen by the
+// extension of path, and replays them in tests. It is set by WithCassette.
+//
+//	cassette, err := client.NewCassette("testdata/users.yaml", client.CassetteReplay)
+//	c := client.NewClient(baseURL, client.WithCassette(cassette))
+type Cassette struct {
+	path            string
+	mode            CassetteMode
+	matchers        []Matcher
+	scrubbedHeaders []string
+	scrubbedFields  []string
+	scrubbedParams  []string
+
+	interactions []Interaction
+	used         []bool
+	mu           sync.Mutex
+}
+
+// NewCassette loads the interactions of path in replay mode.
+func NewCassette(path string, mode CassetteMode, opts ...CassetteOption) (*Cassette, error) {
+	c := &Cassette{
+		path:            path,
+		mode:            mode,
+		matchers:        []Matcher{MatchMethod, MatchURL},
+		scrubbedHeaders: append([]string(nil), defaultScrubbedHeaders...),
+	}
+	for _, o := range opts {
+		o(c)
+	}
+
+	if _, err := cassetteCodec(path); err != nil {
+		return nil, err
+	}
+
+	if mode == CassetteReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = c.unmarshal(data); err != nil {
+			return nil, fmt.Errorf("decode cassette %s: %w", path, err)
+		}
+		c.used = make([]bool, len(c.interactions))
+	}
+
+	return c, nil
+}
+
+// Save writes the recorded interactions. It does nothing in replay mode.
+func (c *Cassette) Save() error {
+	if c.mode != CassetteRecord {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := c.marshal()
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
+
+// Unused returns the interactions not replayed yet, to check that a test sent every request.
+func (c *Cassette) Unused() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var unused []Interaction
+	for i, used := range c.used {
+		if !used {
+			unused = append(unused, c.interactions[i])
+		}
+	}
+	return unused
+}
+
+// replaying reports whether c answers the requests offline. The credentials are never
+// recorded, so the auth provider of the client is skipped.
+func (c *Cassette) replaying() bool {
+	return c != nil && c.mode == CassetteReplay
+}
+
+// transport returns the transport of a client; scrubbedFields and scrubbedParams are the
+// fields the client encrypts in its logs.
+func (c *Cassette) transport(next http.RoundTripper, scrubbedFields, scrubbedParams []string) http.RoundTripper {
+	c.mu.Lock()
+	c.scrubbedFields = append(c.scrubbedFields, scrubbedFields...)
+	c.scrubbedParams = append(c.scrubbedParams, scrubbedParams...)
+	c.mu.Unlock()
+
+	return &cassetteTransport{cassette: c, next: next}
+}
+
+type cassetteTransport struct {
+	cassette *Cassette
+	next     http.RoundTripper
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	c := t.cassette
+
+	reqBody, err := readBody(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the fields encrypted in the logs of this request are scrubbed too
+	opts := requestOptionsFromContext(req.Context())
+	fields := append(append([]string(nil), opts.reqBodyEncrypt...), opts.respBodyEncrypt...)
+	recordedReq := c.scrubRequest(req, reqBody, fields, opts.queryParamsEncrypt)
+
+	if c.mode == CassetteReplay {
+		interaction, err := c.match(recordedReq)
+		if err != nil {
+			return nil, err
+		}
+		return interaction.Response.httpResponse(req), nil
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	respBody, err := readBody(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.interactions = append(c.interactions, Interaction{
+		Request: recordedReq,
+		Response: CassetteResponse{
+			StatusCode: resp.StatusCode,
+			Header:     c.scrubHeader(resp.Header),
+			Body:       c.scrubBody(string(respBody), fields),
+		},
+	})
+	c.mu.Unlock()
+
+	return resp, nil
+}
+
+func (t *cassetteTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+// match returns the first interaction not replayed yet matching req.
+func (c *Cassette) match(req CassetteRequest) (Interaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, interaction := range c.interactions {
+		if c.used[i] {
+			continue
+		}
+
+		matched := true
+		for _, m := range c.matchers {
+			if !m(req, interaction.Request) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			c.used[i] = true
+			return interaction, nil
+		}
+	}
+
+	return Interaction{}, fmt.Errorf("%w: %s %s in %s", ErrCassetteUnmatched, req.Method, req.URL, c.path)
+}
+
+func (c *Cassette) scrubRequest(req *http.Request, body []byte, fields, params []string) CassetteRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	query := req.URL.Query()
+	for _, param := range append(append([]string(nil), c.scrubbedParams...), params...) {
+		if query.Has(param) {
+			query.Set(param, scrubbedValue)
+		}
+	}
+	u := neturl.URL{Path: req.URL.Path, RawQuery: query.Encode()}
+
+	return CassetteRequest{
+		Method: req.Method,
+		URL:    u.String(),
+		Header: c.scrubHeader(req.Header),
+		Body:   c.scrubBody(string(body), fields),
+	}
+}
+
+// scrubHeader is called with the lock of the cassette held.
+func (c *Cassette) scrubHeader(header http.Header) http.Header {
+	header = header.Clone()
+	for _, h := range c.scrubbedHeaders {
+		header.Del(h)
+	}
+	return header
+}
+
+// scrubBody is called with the lock of the cassette held.
+func (c *Cassette) scrubBody(body string, fields []string) string {
+	if !gjson.Valid(body) {
+		return body
+	}
+
+	fields = append(append(append([]string(nil), SensitiveDataInstance.GetSensitiveFields()...), c.scrubbedFields...), fields...)
+	for _, field := range fields {
+		if gjson.Get(body, field).Exists() {
+			body, _ = sjson.Set(body, field, scrubbedValue)
+		}
+	}
+	return body
+}
+
+func (r CassetteResponse) httpResponse(req *http.Request) *http.Response {
+	header := r.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode)),
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(r.Body)),
+		ContentLength: int64(len(r.Body)),
+		Request:       req,
+	}
+}
+
+// readBody reads body and replaces it with a reader of the same bytes.
+func readBody(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	_ = (*body).Close()
+	if err != nil {
+		return nil, err
+	}
+	*body = io.NopCloser(bytes.NewReader(data))
+
+	return data, nil
+}
+
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions" yaml:"interactions"`
+}
+
+func cassetteCodec(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml", nil
+	case ".json":
+		return "json", nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrCassetteFormat, path)
+	}
+}
+
+func (c *Cassette) marshal() ([]byte, error) {
+	file := cassetteFile{Interactions: c.interactions}
+	if codec, _ := cassetteCodec(c.path); codec == "yaml" {
+		return yaml.Marshal(file)
+	}
+	return json.MarshalIndent(file, "", "  ")
+}
+
+func (c *Cassette) unmarshal(data []byte) error {
+	var file cassetteFile
+
+	var err error
+	if codec, _ := cassetteCodec(c.path); codec == "yaml" {
+		err = yaml.Unmarshal(data, &file)
+	} else {
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return err
+	}
+
+	c.interactions = file.Interactions
+	return nil
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	logger "go-source/pkg/log"
+)
+
+func TestCassetteRecordReplay(t *testing.T) {
+	logger.InitLog("test")
+
+	for _, ext := range []string{".yaml", ".json"} {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "users"+ext)
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"data":{"id":"1","email":"alice@example.com","pin":"1234","token":"tok-789"}}`))
+			}))
+
+			recorder, err := NewCassette(path, CassetteRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := NewClient(server.URL, WithCassette(recorder), WithAuth(NewAPIKeyAuth("", "secret-key")),
+				WithEncryptedResponseFields("data.pin"))
+			// per-request fields are scrubbed as well
+			_, err = c.NewRequest(context.Background(), WithRequestEncryptedResponseFields("data.token")).
+				SetBody(map[string]string{"name": "alice", "password": "p4ss"}).
+				Post("/users?expand=roles")
+			server.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = recorder.Save(); err != nil {
+				t.Fatal(err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, secret := range []string{"alice@example.com", "1234", "tok-789", "secret-key"} {
+				if strings.Contains(string(data), secret) {
+					t.Fatalf("cassette contains %q:\n%s", secret, data)
+				}
+			}
+
+			player, err := NewCassette(path, CassetteReplay, WithMatchers(MatchMethod, MatchURL, MatchBody))
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the token endpoint is down, replay must not fetch a token
+			c = NewClient(server.URL, WithCassette(player),
+				WithAuth(NewOAuth2Auth(OAuth2Config{TokenURL: server.URL + "/token", ClientID: "id", ClientSecret: "secret"})))
+
+			user, err := Post[map[string]string, map[string]map[string]string](context.Background(), c, "/users?expand=roles",
+				map[string]string{"password": "p4ss", "name": "alice"})
+			if err != nil {
+				t.Fatalf("replay: %v", err)
+			}
+			if user["data"]["id"] != "1" {
+				t.Fatalf("unexpected replayed body: %v", user)
+			}
+
+			_, err = Post[map[string]string, map[string]interface{}](context.Background(), c, "/users?expand=roles",
+				map[string]string{"name": "bob"})
+			if !errors.Is(err, ErrCassetteUnmatched) {
+				t.Fatalf("expected ErrCassetteUnmatched, got %v", err)
+			}
+			if len(player.Unused()) != 0 {
+				t.Fatalf("expected every interaction to be replayed")
+			}
+		})
+	}
+}
@@ -1,9 +1,8 @@
 package client
 
 import (
-	"context"
-	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	logger "go-source/pkg/log"
 	"go-source/pkg/metric"
@@ -11,13 +10,13 @@ import (
 	"net/http"
 	neturl "net/url"
 	"os"
-	"time"
 
 	"github.com/labstack/echo/v4"
 
 	"github.com/go-resty/resty/v2"
 	"github.com/tidwall/gjson"
 	"github.com/tidwall/sjson"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type Client struct {
@@ -25,73 +24,84 @@ type Client struct {
 	keyEncrypt         string
 	fnResp             []ResponseMiddlewareFunc
 	fnReq              []RequestMiddlewareFunc
-	reqBodyEncrypt     []TypeKeyRequestBodyEncrypt
-	respBodyEncrypt    []TypeKeyResponseBodyEncrypt
-	queryParamsEncrypt []TypeKeyQueryParamsEncrypt
+	reqBodyEncrypt     []string
+	respBodyEncrypt    []string
+	queryParamsEncrypt []string
+	retry              *RetryPolicy
+	// transport is the *http.Transport under the round trippers, see Transport.
+	transport *http.Transport
 }
 
 type (
 	ResponseMiddlewareFunc func(client *resty.Client, response *resty.Response) error
 	RequestMiddlewareFunc  func(client *resty.Client, request *resty.Request) error
-
-	TypeKeyRequestBodyEncrypt  string
-	TypeKeyResponseBodyEncrypt string
-	TypeKeyQueryParamsEncrypt  string
 )
 
-const (
-	KeyRestRequestBodyEncrypt  = "rest_request_body_encrypt"
-	KeyRestResponseBodyEncrypt = "rest_response_body_encrypt"
-	KeyRestQueryParamsEncrypt  = "rest_query_params_encrypt"
-
-	KeyOffLogRespBody = "off_log_resp_body"
+var (
+	// ErrStatusCode is returned, wrapped, for the responses whose status is not 200.
+	ErrStatusCode = errors.New("status_code")
+	// ErrRequestMiddleware is returned, wrapped with the error of the middleware, when a
+	// request middleware fails. The request is not sent.
+	ErrRequestMiddleware = errors.New("rest api request middleware failed")
 )
 
-func NewClient(baseURL string, timeout time.Duration, maxRetry int, waitTime time.Duration, fns ...interface{}) *Client {
-	var (
-		fnResp             []ResponseMiddlewareFunc
-		fnReq              []RequestMiddlewareFunc
-		reqBodyEncrypt     []TypeKeyRequestBodyEncrypt
-		respBodyEncrypt    []TypeKeyResponseBodyEncrypt
-		queryParamsEncrypt []TypeKeyQueryParamsEncrypt
-	)
-
-	for _, fn := range fns {
-		switch fn.(type) {
-		case []ResponseMiddlewareFunc:
-			fnResp = append(fnResp, fn.([]ResponseMiddlewareFunc)...)
-		case []RequestMiddlewareFunc:
-			fnReq = append(fnReq, fn.([]RequestMiddlewareFunc)...)
-		case []TypeKeyRequestBodyEncrypt:
-			reqBodyEncrypt = append(reqBodyEncrypt, fn.([]TypeKeyRequestBodyEncrypt)...)
-		case []TypeKeyResponseBodyEncrypt:
-			respBodyEncrypt = append(respBodyEncrypt, fn.([]TypeKeyResponseBodyEncrypt)...)
-		case []TypeKeyQueryParamsEncrypt:
-			queryParamsEncrypt = append(queryParamsEncrypt, fn.([]TypeKeyQueryParamsEncrypt)...)
-		}
+const maskedBody = "******"
+
+func NewClient(baseURL string, opts ...Option) *Client {
+	o := clientOptions{
+		timeout: defaultTimeout,
+		// get key encrypt from env
+		keyEncrypt: os.Getenv(utils.EncryptKey),
+	}
+	for _, opt := range opts {
+		opt(&o)
 	}
 
-	// get key encrypt from env
-	keyEncrypt := os.Getenv(utils.EncryptKey)
+	fnReq := o.fnReq
+	// credentials are set after the other middlewares, HMAC signs the final request; a
+	// replaying cassette needs none, and the token of an OAuth2Auth is not fetched offline
+	if o.auth != nil && !o.cassette.replaying() {
+		fnReq = append(fnReq, o.auth.Authenticate)
+	}
 
 	client := resty.New()
 	client.SetBaseURL(baseURL)
-	client.SetTimeout(timeout)
-	client.SetRetryCount(maxRetry)
-	client.SetRetryWaitTime(waitTime)
-	client.SetTLSClientConfig(&tls.Config{InsecureSkipVerify: true})
+	tlsClientConfig, err := newTLSConfig(o.tls)
+	if err != nil {
+		logger.GetLogger().Fatal().Err(err).Str("base_url", baseURL).Msg("init http client tls failed")
+	}
+	client.SetTLSClientConfig(tlsClientConfig)
 	client.EnableTrace()
 	client.SetDisableWarn(true)
 	client.SetLogger(NoOpLogger{})
 
+	// the timeout is applied by the transport, so that requests can override it
+	transport := client.GetClient().Transport
+	baseTransport, _ := transport.(*http.Transport)
+	if o.cassette != nil {
+		scrubbedFields := append(append([]string(nil), o.reqBodyEncrypt...), o.respBodyEncrypt...)
+		transport = o.cassette.transport(transport, scrubbedFields, o.queryParamsEncrypt)
+	}
+	transport = &timeoutTransport{next: transport, timeout: o.timeout}
+	if o.resilience != nil {
+		transport = newResilientTransport(transport, baseURL, *o.resilience)
+	}
+	client.SetTransport(transport)
+
+	retry := o.retry.withDefaults()
+	retry.auth = o.auth
+	retry.apply(client)
+
 	result := &Client{
 		Client:             client,
-		keyEncrypt:         keyEncrypt,
-		fnResp:             fnResp,
+		keyEncrypt:         o.keyEncrypt,
+		fnResp:             o.fnResp,
 		fnReq:              fnReq,
-		reqBodyEncrypt:     reqBodyEncrypt,
-		respBodyEncrypt:    respBodyEncrypt,
-		queryParamsEncrypt: queryParamsEncrypt,
+		reqBodyEncrypt:     o.reqBodyEncrypt,
+		respBodyEncrypt:    o.respBodyEncrypt,
+		queryParamsEncrypt: o.queryParamsEncrypt,
+		retry:              &retry,
+		transport:          baseTransport,
 	}
 
 	client.OnBeforeRequest(result.beforeRequest)
@@ -105,9 +115,12 @@ func (c *Client) beforeRequest(client *resty.Client, request *resty.Request) err
 	ctxNew, traceInfo := utils.NewContextWithRequestId(ctx)
 	request.SetContext(ctxNew)
 	request.SetHeader(echo.HeaderXRequestID, traceInfo.RequestID)
+	c.retry.prepare(request)
+	utils.InjectTraceContext(ctxNew, propagation.HeaderCarrier(request.Header))
 
 	// get log
 	log := logger.GetLogger().AddTraceInfoContextRequest(request.Context())
+	opts := requestOptionsFromContext(ctx)
 
 	reqBody := request.Body
 
@@ -116,48 +129,24 @@ func (c *Client) beforeRequest(client *resty.Client, request *resty.Request) err
 
 	if c.keyEncrypt != "" {
 		// encrypt request body fields
-
-		var reqBodyEnc []string
-		for _, be := range c.reqBodyEncrypt {
-			reqBodyEnc = append(reqBodyEnc, string(be))
-		}
-
+		reqBodyEnc := append(append([]string(nil), c.reqBodyEncrypt...), opts.reqBodyEncrypt...)
 		if result, err := encryptBodyFields(reqBody, reqBodyEnc, c.keyEncrypt); err != nil {
 			log.Error().Err(err).Msg("encrypt request body fields error")
 		} else {
 			reqBody = result
 		}
 
-		if value, ok := ctx.Value(KeyRestRequestBodyEncrypt).([]string); ok {
-			if result, err := encryptBodyFields(reqBody, value, c.keyEncrypt); err != nil {
-				log.Error().Err(err).Msg("encrypt request body fields error")
-			} else {
-				reqBody = result
-			}
-		}
-
-		// -----------------------------------------------
-
 		// encrypt request query params
-
-		var queryParamsEnc []string
-		for _, qe := range c.queryParamsEncrypt {
-			queryParamsEnc = append(queryParamsEnc, string(qe))
-		}
-
+		queryParamsEnc := append(append([]string(nil), c.queryParamsEncrypt...), opts.queryParamsEncrypt...)
 		if result, err := encryptQueryParams(reqQueryParams, queryParamsEnc, c.keyEncrypt); err != nil {
 			log.Error().Err(err).Msg("encrypt request query params error")
 		} else {
 			reqQueryParams = result
 		}
+	}
 
-		if value, ok := ctx.Value(KeyRestQueryParamsEncrypt).([]string); ok {
-			if result, err := encryptQueryParams(reqQueryParams, value, c.keyEncrypt); err != nil {
-				log.Error().Err(err).Msg("encrypt request query params error")
-			} else {
-				reqQueryParams = result
-			}
-		}
+	if opts.offLogReqBody && reqBody != nil {
+		reqBody = maskedBody
 	}
 
 	// log trace
@@ -169,7 +158,10 @@ func (c *Client) beforeRequest(client *resty.Client, request *resty.Request) err
 		Msg("rest api request")
 
 	for _, fn := range c.fnReq {
-		_ = fn(client, request)
+		if err := fn(client, request); err != nil {
+			log.Err(err).Str("url", reqBaseURL).Msg("rest api request middleware error")
+			return fmt.Errorf("%w: %w", ErrRequestMiddleware, err)
+		}
 	}
 
 	return nil
@@ -180,6 +172,7 @@ func (c *Client) afterResponse(client *resty.Client, response *resty.Response) e
 
 	// get log
 	log := logger.GetLogger().AddTraceInfoContextRequest(ctx)
+	opts := requestOptionsFromContext(ctx)
 
 	// get trace request
 	trace := response.Request.TraceInfo()
@@ -192,11 +185,8 @@ func (c *Client) afterResponse(client *resty.Client, response *resty.Response) e
 	reqBody := response.Request.Body
 
 	var respBody interface{}
-
-	valOffLogRespBody := ctx.Value(KeyOffLogRespBody)
-	value, ok := valOffLogRespBody.(bool)
-	if ok && value && len(response.Body()) > 0 {
-		respBody = "******"
+	if opts.offLogRespBody && len(response.Body()) > 0 {
+		respBody = maskedBody
 	} else {
 		respBody = response.Body()
 	}
@@ -208,70 +198,32 @@ func (c *Client) afterResponse(client *resty.Client, response *resty.Response) e
 
 	if c.keyEncrypt != "" {
 		// encrypt request body fields
-		var reqBodyEnc []string
-		for _, be := range c.reqBodyEncrypt {
-			reqBodyEnc = append(reqBodyEnc, string(be))
-		}
-
+		reqBodyEnc := append(append([]string(nil), c.reqBodyEncrypt...), opts.reqBodyEncrypt...)
 		if result, err := encryptBodyFields(reqBody, reqBodyEnc, c.keyEncrypt); err != nil {
 			log.Error().Err(err).Msg("encrypt request body fields error")
 		} else {
 			reqBody = result
 		}
 
-		if value, ok := ctx.Value(KeyRestRequestBodyEncrypt).([]string); ok {
-			if result, err := encryptBodyFields(reqBody, value, c.keyEncrypt); err != nil {
-				log.Error().Err(err).Msg("encrypt request body fields error")
-			} else {
-				reqBody = result
-			}
-		}
-
-		// -----------------------------------------------
-
 		// encrypt response body fields
-
-		var respBodyEnc []string
-		for _, be := range c.respBodyEncrypt {
-			respBodyEnc = append(respBodyEnc, string(be))
-		}
-
+		respBodyEnc := append(append([]string(nil), c.respBodyEncrypt...), opts.respBodyEncrypt...)
 		if result, err := encryptBodyFields(respBody, respBodyEnc, c.keyEncrypt); err != nil {
 			log.Error().Err(err).Msg("encrypt response body fields error")
 		} else {
 			respBody = result
 		}
 
-		if value, ok := ctx.Value(KeyRestResponseBodyEncrypt).([]string); ok {
-			if result, err := encryptBodyFields(respBody, value, c.keyEncrypt); err != nil {
-				log.Error().Err(err).Msg("encrypt response body fields error")
-			} else {
-				respBody = result
-			}
-		}
-
-		// -----------------------------------------------
-
 		// encrypt request query params
-
-		var queryParamsEnc []string
-		for _, qe := range c.queryParamsEncrypt {
-			queryParamsEnc = append(queryParamsEnc, string(qe))
-		}
-
+		queryParamsEnc := append(append([]string(nil), c.queryParamsEncrypt...), opts.queryParamsEncrypt...)
 		if result, err := encryptQueryParams(reqQueryParams, queryParamsEnc, c.keyEncrypt); err != nil {
 			log.Error().Err(err).Msg("encrypt request query params error")
 		} else {
 			reqQueryParams = result
 		}
+	}
 
-		if value, ok := ctx.Value(KeyRestQueryParamsEncrypt).([]string); ok {
-			if result, err := encryptQueryParams(reqQueryParams, value, c.keyEncrypt); err != nil {
-				log.Error().Err(err).Msg("encrypt request query params error")
-			} else {
-				reqQueryParams = result
-			}
-		}
+	if opts.offLogReqBody && reqBody != nil {
+		reqBody = maskedBody
 	}
 
 	metric.NewHttpClientHistogramDuration(reqBaseURL, response.Request.Method, response.Status(), response.Time())
@@ -294,7 +246,7 @@ func (c *Client) afterResponse(client *resty.Client, response *resty.Response) e
 		Str("total_time", trace.TotalTime.String()).
 		Str("conn_idle_time", trace.ConnIdleTime.String()).
 		Int("request_attempt", trace.RequestAttempt).
-		Str("remote_addr", trace.RemoteAddr.String()).
+		Stringer("remote_addr", trace.RemoteAddr).
 		Interface("request_body", reqBody).
 		Str("response_body", func() string {
 			data, err := utils.AnyToString(respBody)
@@ -306,24 +258,23 @@ func (c *Client) afterResponse(client *resty.Client, response *resty.Response) e
 		}()).
 		Msg("rest api response")
 
+	for _, fn := range c.fnResp {
+		if err := fn(client, response); err != nil {
+			return err
+		}
+	}
+
 	if response.StatusCode() != http.StatusOK {
 		if len(response.Body()) > 0 {
 			_ = json.Unmarshal(response.Body(), &response.Request.Result)
 		}
 
-		return fmt.Errorf("status_code: %d", response.StatusCode())
+		return fmt.Errorf("%w: %d", ErrStatusCode, response.StatusCode())
 	}
 
 	return nil
 }
 
-func OffLogRespBody(client *resty.Client, request *resty.Request) error {
-	ctx := request.Context()
-	ctxNew := context.WithValue(ctx, KeyOffLogRespBody, true)
-	request.SetContext(ctxNew)
-	return nil
-}
-
 func encryptBodyFields(body interface{}, bodyFields []string, secretKey string) (interface{}, error) {
 	if len(bodyFields) == 0 {
 		return body, nil
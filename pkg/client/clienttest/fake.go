@@ -0,0 +1,116 @@
+// Package clienttest provides a fake service for the tests of code calling pkg/client.
+package clienttest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"go-source/pkg/client"
+)
+
+// RecordedRequest is a request received by the fake.
+type RecordedRequest struct {
+	Method string
+	Path   string
+	Query  string
+	Header http.Header
+	Body   []byte
+}
+
+// Fake is an httptest server answering with the handlers registered per method and path.
+// Unregistered routes answer 404 with an error envelope.
+type Fake struct {
+	server   *httptest.Server
+	handlers map[string]http.HandlerFunc
+	requests []RecordedRequest
+	mu       sync.Mutex
+}
+
+func NewFake() *Fake {
+	f := &Fake{handlers: make(map[string]http.HandlerFunc)}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveHTTP))
+	return f
+}
+
+// URL is the base URL of the fake.
+func (f *Fake) URL() string {
+	return f.server.URL
+}
+
+func (f *Fake) Close() {
+	f.server.Close()
+}
+
+// Client returns a client of the fake, with a timeout of 5 seconds before opts.
+func (f *Fake) Client(opts ...client.Option) *client.Client {
+	return client.NewClient(f.server.URL, append([]client.Option{client.WithTimeout(5 * time.Second)}, opts...)...)
+}
+
+func (f *Fake) Handle(method, path string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	f.handlers[method+" "+path] = handler
+	f.mu.Unlock()
+}
+
+// Reply answers method and path with status and body encoded as JSON.
+func (f *Fake) Reply(method, path string, status int, body interface{}) {
+	f.Handle(method, path, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, status, body)
+	})
+}
+
+// ReplyError answers method and path with status and the error envelope of the services.
+func (f *Fake) ReplyError(method, path string, status int, errorCode interface{}, message, description string) {
+	f.Reply(method, path, status, map[string]interface{}{
+		"errorCode":   errorCode,
+		"message":     message,
+		"description": description,
+	})
+}
+
+// Requests returns the requests received so far, in order.
+func (f *Fake) Requests() []RecordedRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]RecordedRequest(nil), f.requests...)
+}
+
+func (f *Fake) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	f.mu.Lock()
+	f.requests = append(f.requests, RecordedRequest{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.RawQuery,
+		Header: r.Header.Clone(),
+		Body:   body,
+	})
+	handler, ok := f.handlers[r.Method+" "+r.URL.Path]
+	f.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"errorCode":   http.StatusNotFound,
+			"message":     "Not found",
+			"description": "no fake handler for " + r.Method + " " + r.URL.Path,
+		})
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	handler(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if body != nil {
+		_ = json.NewEncoder(w).Encode(body)
+	}
+}
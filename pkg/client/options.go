@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+const (
+	defaultTimeout = 30 * time.Second
+
+	// keyRequestOptions holds the options of a request created by NewRequest
+	keyRequestOptions = "rest_request_options"
+)
+
+// Option configures a client created by NewClient.
+type Option func(o *clientOptions)
+
+type clientOptions struct {
+	timeout            time.Duration
+	keyEncrypt         string
+	fnReq              []RequestMiddlewareFunc
+	fnResp             []ResponseMiddlewareFunc
+	reqBodyEncrypt     []string
+	respBodyEncrypt    []string
+	queryParamsEncrypt []string
+	retry              RetryPolicy
+	resilience         *Resilience
+	tls                TLSConfig
+	auth               AuthProvider
+	cassette           *Cassette
+}
+
+// WithTimeout bounds every attempt of a request. It defaults to 30 seconds.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *clientOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRequestMiddleware adds middlewares run before every attempt of a request. An error
+// aborts the request.
+func WithRequestMiddleware(fns ...RequestMiddlewareFunc) Option {
+	return func(o *clientOptions) {
+		o.fnReq = append(o.fnReq, fns...)
+	}
+}
+
+// WithResponseMiddleware adds middlewares run after every response. An error is returned to
+// the caller.
+func WithResponseMiddleware(fns ...ResponseMiddlewareFunc) Option {
+	return func(o *clientOptions) {
+		o.fnResp = append(o.fnResp, fns...)
+	}
+}
+
+// WithEncryptKey replaces the key read from the ENCRYPT_KEY env.
+func WithEncryptKey(key string) Option {
+	return func(o *clientOptions) {
+		o.keyEncrypt = key
+	}
+}
+
+// WithEncryptedBodyFields encrypts the request body fields, given as gjson paths, in the logs.
+func WithEncryptedBodyFields(fields ...string) Option {
+	return func(o *clientOptions) {
+		o.reqBodyEncrypt = append(o.reqBodyEncrypt, fields...)
+	}
+}
+
+// WithEncryptedResponseFields encrypts the response body fields, given as gjson paths, in the logs.
+func WithEncryptedResponseFields(fields ...string) Option {
+	return func(o *clientOptions) {
+		o.respBodyEncrypt = append(o.respBodyEncrypt, fields...)
+	}
+}
+
+// WithEncryptedQueryParams encrypts the query params in the logs.
+func WithEncryptedQueryParams(params ...string) Option {
+	return func(o *clientOptions) {
+		o.queryParamsEncrypt = append(o.queryParamsEncrypt, params...)
+	}
+}
+
+// WithRetryPolicy retries the requests following policy. Requests are not retried by default.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(o *clientOptions) {
+		o.retry = policy
+	}
+}
+
+func WithResilience(resilience Resilience) Option {
+	return func(o *clientOptions) {
+		o.resilience = &resilience
+	}
+}
+
+func WithTLS(cfg TLSConfig) Option {
+	return func(o *clientOptions) {
+		o.tls = cfg
+	}
+}
+
+func WithAuth(auth AuthProvider) Option {
+	return func(o *clientOptions) {
+		o.auth = auth
+	}
+}
+
+// WithCassette records or replays the requests of the client, see Cassette. In replay mode
+// the provider of WithAuth is not called, so that an OAuth2Auth fetches no token: the
+// credentials are not in the cassette and not matched.
+func WithCassette(cassette *Cassette) Option {
+	return func(o *clientOptions) {
+		o.cassette = cassette
+	}
+}
+
+// RequestOption overrides the options of the client for one request.
+type RequestOption func(o *requestOptions)
+
+type requestOptions struct {
+	timeout            time.Duration
+	offLogReqBody      bool
+	offLogRespBody     bool
+	reqBodyEncrypt     []string
+	respBodyEncrypt    []string
+	queryParamsEncrypt []string
+}
+
+// WithRequestTimeout replaces the timeout of the client for every attempt of the request.
+func WithRequestTimeout(timeout time.Duration) RequestOption {
+	return func(o *requestOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithoutRequestBodyLog masks the request body in the logs.
+func WithoutRequestBodyLog() RequestOption {
+	return func(o *requestOptions) {
+		o.offLogReqBody = true
+	}
+}
+
+// WithoutResponseBodyLog masks the response body in the logs.
+func WithoutResponseBodyLog() RequestOption {
+	return func(o *requestOptions) {
+		o.offLogRespBody = true
+	}
+}
+
+// WithRequestEncryptedBodyFields encrypts request body fields in the logs, besides the ones of the client.
+func WithRequestEncryptedBodyFields(fields ...string) RequestOption {
+	return func(o *requestOptions) {
+		o.reqBodyEncrypt = append(o.reqBodyEncrypt, fields...)
+	}
+}
+
+// WithRequestEncryptedResponseFields encrypts response body fields in the logs, besides the ones of the client.
+func WithRequestEncryptedResponseFields(fields ...string) RequestOption {
+	return func(o *requestOptions) {
+		o.respBodyEncrypt = append(o.respBodyEncrypt, fields...)
+	}
+}
+
+// WithRequestEncryptedQueryParams encrypts query params in the logs, besides the ones of the client.
+func WithRequestEncryptedQueryParams(params ...string) RequestOption {
+	return func(o *requestOptions) {
+		o.queryParamsEncrypt = append(o.queryParamsEncrypt, params...)
+	}
+}
+
+// NewRequest returns a request of the client with ctx and the request options.
+func (c *Client) NewRequest(ctx context.Context, opts ...RequestOption) *resty.Request {
+	return c.R().SetContext(ContextWithRequestOptions(ctx, opts...))
+}
+
+// ContextWithRequestOptions returns a context applying the request options to the requests
+// sent with it, for the callers building their requests with R().
+func ContextWithRequestOptions(ctx context.Context, opts ...RequestOption) context.Context {
+	if len(opts) == 0 {
+		return ctx
+	}
+
+	o := &requestOptions{}
+	if previous, ok := ctx.Value(keyRequestOptions).(*requestOptions); ok {
+		*o = *previous
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return context.WithValue(ctx, keyRequestOptions, o)
+}
+
+func requestOptionsFromContext(ctx context.Context) *requestOptions {
+	if ctx != nil {
+		if o, ok := ctx.Value(keyRequestOptions).(*requestOptions); ok {
+			return o
+		}
+	}
+	return &requestOptions{}
+}
+
+// timeoutTransport bounds every attempt with the timeout of the request, or of the client.
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	timeout := t.timeout
+	if o := requestOptionsFromContext(req.Context()); o.timeout > 0 {
+		timeout = o.timeout
+	}
+	if timeout <= 0 {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the body is read after RoundTrip returns, the timeout ends when it is closed
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (t *timeoutTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// closeIdleConnections forwards http.Client.CloseIdleConnections through the wrapping transports.
+func closeIdleConnections(transport http.RoundTripper) {
+	if c, ok := transport.(interface{ CloseIdleConnections() }); ok {
+		c.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	logger "go-source/pkg/log"
+)
+
+func TestRequestMiddlewareErrorAbortsRequest(t *testing.T) {
+	logger.InitLog("test")
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer server.Close()
+
+	errRegion := errors.New("region not found in context")
+	c := NewClient(server.URL, WithRequestMiddleware(func(client *resty.Client, request *resty.Request) error {
+		return errRegion
+	}))
+
+	_, err := c.NewRequest(context.Background()).Get("/")
+	if !errors.Is(err, ErrRequestMiddleware) || !errors.Is(err, errRegion) {
+		t.Fatalf("expected the middleware error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 0 {
+		t.Fatalf("expected the request not to be sent, got %d calls", n)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	logger.InitLog("test")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithTimeout(10*time.Millisecond))
+
+	if _, err := c.NewRequest(context.Background()).Get("/"); err == nil {
+		t.Fatal("expected the client timeout to apply")
+	}
+	if _, err := c.NewRequest(context.Background(), WithRequestTimeout(time.Second)).Get("/"); err != nil {
+		t.Fatalf("expected the request timeout to override the client one: %v", err)
+	}
+}
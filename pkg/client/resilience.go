@@ -0,0 +1,169 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+
+	"go-source/pkg/breaker"
+	logger "go-source/pkg/log"
+	"go-source/pkg/metric"
+)
+
+var (
+	// ErrCircuitOpen is returned, wrapped, for requests rejected by an open circuit breaker.
+	ErrCircuitOpen = errors.New("http client circuit breaker is open")
+	// ErrBulkheadFull is returned, wrapped, for requests that found no free bulkhead slot in time.
+	ErrBulkheadFull = errors.New("http client bulkhead is full")
+)
+
+// codes of the http_client_rejected metric
+const (
+	codeCircuitOpen  = "CIRCUIT_OPEN"
+	codeBulkheadFull = "BULKHEAD_FULL"
+)
+
+// Resilience guards the requests of a client with circuit breakers and a bulkhead. It is
+// set by WithResilience.
+type Resilience struct {
+	// Name identifies the client in logs and metrics. It defaults to the host of the base URL.
+	Name    string
+	Breaker breaker.Config
+	// PerHost keeps a breaker per host instead of one for the client.
+	PerHost bool
+	// MaxConcurrent limits the requests in flight. Zero disables the bulkhead.
+	MaxConcurrent int
+	// MaxWait is how long a request waits for a bulkhead slot. Zero fails at once.
+	MaxWait time.Duration
+}
+
+// resilientTransport applies the breakers and the bulkhead to every attempt of a request.
+// Transport errors and 5xx responses count as breaker failures.
+type resilientTransport struct {
+	next     http.RoundTripper
+	cfg      Resilience
+	slots    chan struct{}
+	breakers map[string]*breaker.Breaker
+	mu       sync.Mutex
+}
+
+func newResilientTransport(next http.RoundTripper, baseURL string, cfg Resilience) *resilientTransport {
+	if cfg.Name == "" {
+		cfg.Name = baseURL
+		if u, err := neturl.Parse(baseURL); err == nil && u.Host != "" {
+			cfg.Name = u.Host
+		}
+	}
+
+	t := &resilientTransport{
+		next:     next,
+		cfg:      cfg,
+		breakers: make(map[string]*breaker.Breaker),
+	}
+	if cfg.MaxConcurrent > 0 {
+		t.slots = make(chan struct{}, cfg.MaxConcurrent)
+	}
+
+	return t
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.acquire(req.Context()); err != nil {
+		if errors.Is(err, ErrBulkheadFull) {
+			metric.RecordHttpClientRejected(t.cfg.Name, codeBulkheadFull)
+		}
+		return nil, err
+	}
+	defer t.release()
+
+	b := t.breaker(req.URL.Host)
+	if err := b.Allow(); err != nil {
+		metric.RecordHttpClientRejected(b.Name(), codeCircuitOpen)
+		return nil, fmt.Errorf("%w: %s: %v", ErrCircuitOpen, b.Name(), err)
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		b.Done(err)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		b.Done(fmt.Errorf("status_code: %d", resp.StatusCode))
+	default:
+		b.Done(nil)
+	}
+
+	return resp, err
+}
+
+func (t *resilientTransport) CloseIdleConnections() {
+	closeIdleConnections(t.next)
+}
+
+func (t *resilientTransport) breaker(host string) *breaker.Breaker {
+	name := t.cfg.Name
+	if t.cfg.PerHost && host != "" {
+		name = t.cfg.Name + "/" + host
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	b, ok := t.breakers[name]
+	if !ok {
+		b = breaker.New(name, t.cfg.Breaker, breaker.WithOnStateChange(logBreakerStateChange))
+		t.breakers[name] = b
+	}
+	return b
+}
+
+func (t *resilientTransport) acquire(ctx context.Context) error {
+	if t.slots == nil {
+		return nil
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if t.cfg.MaxWait <= 0 {
+		return fmt.Errorf("%w: %s", ErrBulkheadFull, t.cfg.Name)
+	}
+
+	timer := time.NewTimer(t.cfg.MaxWait)
+	defer timer.Stop()
+
+	select {
+	case t.slots <- struct{}{}:
+		return nil
+	case <-timer.C:
+		return fmt.Errorf("%w: %s", ErrBulkheadFull, t.cfg.Name)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *resilientTransport) release() {
+	if t.slots != nil {
+		<-t.slots
+	}
+}
+
+func logBreakerStateChange(name string, from, to breaker.State) {
+	metric.RecordCircuitBreakerState(metric.HttpComponent, name, int64(to))
+	logger.GetLogger().Warn().
+		Str("breaker", name).
+		Str("from", from.String()).
+		Str("to", to.String()).
+		Msg("http client circuit breaker state changed")
+}
+
+// isRejected reports whether err comes from a breaker or the bulkhead, which must not be retried.
+func isRejected(err error) bool {
+	return errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrBulkheadFull)
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-source/pkg/breaker"
+	logger "go-source/pkg/log"
+)
+
+func TestResilienceOpensCircuit(t *testing.T) {
+	logger.InitLog("test")
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithTimeout(time.Second), WithResilience(Resilience{
+		Breaker: breaker.Config{FailureThreshold: 2, OpenTimeout: time.Minute, HalfOpenMaxRequests: 1, SuccessThreshold: 1},
+	}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.R().SetContext(context.Background()).Get("/"); err == nil || isRejected(err) {
+			t.Fatalf("request %d: expected a status error, got %v", i, err)
+		}
+	}
+
+	_, err := c.R().SetContext(context.Background()).Get("/")
+	if !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("expected 2 calls to reach the server, got %d", n)
+	}
+}
+
+func TestResilienceBulkheadFull(t *testing.T) {
+	logger.InitLog("test")
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	c := NewClient(server.URL, WithTimeout(time.Second), WithResilience(Resilience{MaxConcurrent: 1}))
+
+	go func() {
+		_, _ = c.R().SetContext(context.Background()).Get("/")
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	_, err := c.R().SetContext(context.Background()).Get("/")
+	if !errors.Is(err, ErrBulkheadFull) {
+		t.Fatalf("expected ErrBulkheadFull, got %v", err)
+	}
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+
+	"go-source/pkg/utils"
+)
+
+// HeaderIdempotencyKey marks a request as safe to retry whatever its method.
+const HeaderIdempotencyKey = "Idempotency-Key"
+
+const (
+	defaultRetryInitialWait = 100 * time.Millisecond
+	defaultRetryMaxWait     = 2 * time.Second
+	defaultRetryMultiplier  = 2
+
+	// keyRetryStart holds the time of the first attempt of a request
+	keyRetryStart = "rest_retry_start"
+)
+
+// ErrRetryBudgetExceeded stops retrying when the next wait would exceed MaxElapsedTime. The
+// error of the last attempt is returned when there is one.
+var ErrRetryBudgetExceeded = errors.New("http client retry budget exceeded")
+
+var (
+	// safeMethods are retried by default, as they do not change the state of the service
+	safeMethods = []string{http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace}
+
+	defaultRetryStatusCodes = []int{
+		http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+// RetryPolicy decides which requests are retried and how long to wait between attempts. It
+// is set by WithRetryPolicy.
+//
+// Waits grow exponentially from InitialWait up to MaxWait, with full jitter. A Retry-After
+// header of the response takes precedence. Only the safe methods, and the requests carrying an
+// Idempotency-Key header, are retried; POST requests get a generated key.
+type RetryPolicy struct {
+	MaxRetries  int
+	InitialWait time.Duration
+	MaxWait     time.Duration
+	Multiplier  float64
+	// MaxElapsedTime bounds the time spent on a request, attempts and waits included. Zero
+	// disables the bound.
+	MaxElapsedTime time.Duration
+	// Methods are retried without an Idempotency-Key header. They default to the safe methods.
+	Methods []string
+	// StatusCodes are the responses worth another attempt. Transport errors are always retried.
+	StatusCodes []int
+	// DisableIdempotencyKey stops generating an Idempotency-Key header for POST requests.
+	DisableIdempotencyKey bool
+
+	// auth is the auth provider of the client, whose 401 responses are retried once
+	auth AuthProvider
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.InitialWait <= 0 {
+		p.InitialWait = defaultRetryInitialWait
+	}
+	if p.MaxWait <= 0 {
+		p.MaxWait = defaultRetryMaxWait
+	}
+	if p.MaxWait < p.InitialWait {
+		p.MaxWait = p.InitialWait
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = defaultRetryMultiplier
+	}
+	if p.Methods == nil {
+		p.Methods = safeMethods
+	}
+	if p.StatusCodes == nil {
+		p.StatusCodes = defaultRetryStatusCodes
+	}
+	return p
+}
+
+// apply sets the policy on the resty client, replacing its backoff and retry conditions.
+func (p *RetryPolicy) apply(client *resty.Client) {
+	retries := p.MaxRetries
+	if p.auth != nil && retries < 1 {
+		retries = 1
+	}
+	client.SetRetryCount(retries)
+	// the waits are computed by backoff, resty only bounds them
+	client.SetRetryWaitTime(time.Nanosecond)
+	client.SetRetryMaxWaitTime(time.Duration(math.MaxInt64))
+	client.SetRetryAfter(p.backoff)
+	client.AddRetryCondition(p.shouldRetry)
+}
+
+// prepare is called before every attempt of a request.
+func (p *RetryPolicy) prepare(request *resty.Request) {
+	if p.MaxRetries <= 0 && p.auth == nil {
+		return
+	}
+
+	ctx := request.Context()
+	if _, ok := ctx.Value(keyRetryStart).(time.Time); !ok {
+		request.SetContext(context.WithValue(ctx, keyRetryStart, time.Now()))
+	}
+
+	if request.Method == http.MethodPost && !p.DisableIdempotencyKey && request.Header.Get(HeaderIdempotencyKey) == "" {
+		request.SetHeader(HeaderIdempotencyKey, utils.GenerateID())
+	}
+}
+
+func (p *RetryPolicy) shouldRetry(response *resty.Response, err error) bool {
+	if response == nil || isRejected(err) {
+		return false
+	}
+	if retryUnauthorized(p.auth, response) {
+		return true
+	}
+	// the retries of resty may include one for the auth provider
+	if response.Request.Attempt > p.MaxRetries || !p.retryable(response.Request) {
+		return false
+	}
+
+	// transport error, no response was received
+	if response.RawResponse == nil {
+		return err != nil
+	}
+
+	for _, code := range p.StatusCodes {
+		if response.StatusCode() == code {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) retryable(request *resty.Request) bool {
+	if request.Header.Get(HeaderIdempotencyKey) != "" {
+		return true
+	}
+	for _, method := range p.Methods {
+		if request.Method == method {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the wait before the next attempt, or ErrRetryBudgetExceeded to stop retrying.
+func (p *RetryPolicy) backoff(_ *resty.Client, response *resty.Response) (time.Duration, error) {
+	// new credentials are tried at once
+	if response.StatusCode() == http.StatusUnauthorized {
+		return time.Nanosecond, nil
+	}
+
+	wait, ok := retryAfter(response)
+	if !ok {
+		attempt := response.Request.Attempt - 1
+		if attempt < 0 {
+			attempt = 0
+		}
+		limit := math.Min(float64(p.MaxWait), float64(p.InitialWait)*math.Pow(p.Multiplier, float64(attempt)))
+		// full jitter; resty uses its own backoff for a zero wait
+		wait = time.Duration(rand.Int63n(int64(limit)) + 1)
+	}
+
+	if p.MaxElapsedTime > 0 {
+		start, ok := response.Request.Context().Value(keyRetryStart).(time.Time)
+		if ok && time.Since(start)+wait > p.MaxElapsedTime {
+			return 0, ErrRetryBudgetExceeded
+		}
+	}
+
+	return wait, nil
+}
+
+// retryAfter reads the Retry-After header, given in seconds or as an HTTP date.
+func retryAfter(response *resty.Response) (time.Duration, bool) {
+	if response.RawResponse == nil {
+		return 0, false
+	}
+
+	value := response.Header().Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		if seconds == 0 {
+			return time.Nanosecond, true
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait <= 0 {
+			wait = time.Nanosecond
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+// flakyServer answers 503 to the first failures requests, then 200.
+func flakyServer(failures int) (*httptest.Server, func() []*http.Request) {
+	var (
+		mu       sync.Mutex
+		requests []*http.Request
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		n := len(requests)
+		mu.Unlock()
+
+		if n <= failures {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	return server, func() []*http.Request {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*http.Request(nil), requests...)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	logger.InitLog("test")
+
+	tests := []struct {
+		name     string
+		policy   RetryPolicy
+		method   string
+		header   string
+		wantErr  bool
+		attempts int
+	}{
+		{name: "get is retried", policy: RetryPolicy{MaxRetries: 3}, method: http.MethodGet, attempts: 3},
+		{name: "post gets an idempotency key", policy: RetryPolicy{MaxRetries: 3}, method: http.MethodPost, attempts: 3},
+		{name: "post without key is not retried", policy: RetryPolicy{MaxRetries: 3, DisableIdempotencyKey: true}, method: http.MethodPost, wantErr: true, attempts: 1},
+		{name: "patch with key is retried", policy: RetryPolicy{MaxRetries: 3}, method: http.MethodPatch, header: "key", attempts: 3},
+		{name: "retries are bounded", policy: RetryPolicy{MaxRetries: 1}, method: http.MethodGet, wantErr: true, attempts: 2},
+		{
+			name:     "elapsed time is bounded",
+			policy:   RetryPolicy{MaxRetries: 3, InitialWait: time.Second, MaxWait: time.Second, MaxElapsedTime: time.Millisecond},
+			method:   http.MethodGet,
+			wantErr:  true,
+			attempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := flakyServer(2)
+			defer server.Close()
+
+			tt.policy.InitialWait = max(tt.policy.InitialWait, time.Millisecond)
+			c := NewClient(server.URL, WithTimeout(time.Second), WithRetryPolicy(tt.policy))
+
+			request := c.R().SetContext(context.Background())
+			if tt.header != "" {
+				request.SetHeader(HeaderIdempotencyKey, tt.header)
+			}
+			_, err := request.Execute(tt.method, "/")
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			got := requests()
+			if len(got) != tt.attempts {
+				t.Fatalf("attempts = %d, want %d", len(got), tt.attempts)
+			}
+
+			key := got[0].Header.Get(HeaderIdempotencyKey)
+			for _, r := range got[1:] {
+				if r.Header.Get(HeaderIdempotencyKey) != key {
+					t.Fatalf("idempotency key changed between attempts")
+				}
+			}
+			if tt.method == http.MethodPost && !tt.policy.DisableIdempotencyKey && key == "" {
+				t.Fatalf("expected a generated idempotency key")
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	logger.InitLog("test")
+
+	var attempts []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts = append(attempts, time.Now())
+		if len(attempts) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	c := NewClient(server.URL, WithTimeout(time.Second), WithRetryPolicy(RetryPolicy{MaxRetries: 1, InitialWait: time.Millisecond}))
+	if _, err := c.R().SetContext(context.Background()).Get("/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(attempts) != 2 {
+		t.Fatalf("attempts = %d, want 2", len(attempts))
+	}
+	if wait := attempts[1].Sub(attempts[0]); wait < time.Second {
+		t.Fatalf("waited %s, want at least the Retry-After of 1s", wait)
+	}
+}
@@ -0,0 +1,232 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+const defaultTLSReloadInterval = time.Minute
+
+var ErrInvalidTLSConfig = errors.New("invalid http client tls config")
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSConfig secures the connections of a client. It is set by WithTLS; without it, the server
+// is verified against the system roots.
+//
+// The CA bundle and the client certificate are read again when their files change, checked
+// at most every ReloadInterval, so that rotated certificates are used without a restart.
+type TLSConfig struct {
+	// CAFile is a PEM bundle replacing the system roots.
+	CAFile string `env:"CA_FILE"`
+	// CertFile and KeyFile are the PEM client certificate and key for mTLS.
+	CertFile string `env:"CERT_FILE"`
+	KeyFile  string `env:"KEY_FILE"`
+	// MinVersion is "1.2" or "1.3". It defaults to "1.2".
+	MinVersion string `env:"MIN_VERSION" envDefault:"1.2"`
+	// ServerName overrides the SNI and the name verified in the server certificate.
+	ServerName     string        `env:"SERVER_NAME"`
+	ReloadInterval time.Duration `env:"RELOAD_INTERVAL" envDefault:"1m"`
+	// InsecureSkipVerifyDevOnly disables the verification of the server. It must only be
+	// used against local services during development.
+	InsecureSkipVerifyDevOnly bool `env:"INSECURE_SKIP_VERIFY_DEV_ONLY"`
+}
+
+// newTLSConfig builds the tls.Config of a client. The files are read once here, so that a
+// wrong path fails at startup.
+func newTLSConfig(cfg TLSConfig) (*tls.Config, error) {
+	minVersion := uint16(tls.VersionTLS12)
+	if cfg.MinVersion != "" {
+		v, ok := tlsVersions[cfg.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("%w: min version %q", ErrInvalidTLSConfig, cfg.MinVersion)
+		}
+		minVersion = v
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, fmt.Errorf("%w: cert file and key file go together", ErrInvalidTLSConfig)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: cfg.ServerName,
+	}
+
+	if cfg.InsecureSkipVerifyDevOnly {
+		logger.GetLogger().Warn().
+			Str("server_name", cfg.ServerName).
+			Msg("http client tls verification is disabled, this must only be used in development")
+		tlsConfig.InsecureSkipVerify = true
+	}
+
+	if cfg.CAFile == "" && cfg.CertFile == "" {
+		return tlsConfig, nil
+	}
+
+	if cfg.ReloadInterval <= 0 {
+		cfg.ReloadInterval = defaultTLSReloadInterval
+	}
+	reloader := &certReloader{cfg: cfg}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+
+	if cfg.CertFile != "" {
+		tlsConfig.GetClientCertificate = reloader.clientCertificate
+	}
+
+	if cfg.CAFile != "" && !cfg.InsecureSkipVerifyDevOnly {
+		// the roots change on reload, which RootCAs does not allow: the default verification
+		// is replaced by verifyConnection, that checks the chain and the name the same way.
+		tlsConfig.InsecureSkipVerify = true
+		tlsConfig.VerifyConnection = reloader.verifyConnection
+	}
+
+	return tlsConfig, nil
+}
+
+// certReloader holds the CA bundle and the client certificate read from the files.
+type certReloader struct {
+	cfg TLSConfig
+
+	roots     *x509.CertPool
+	cert      *tls.Certificate
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+	mu        sync.RWMutex
+}
+
+func (r *certReloader) files() []string {
+	var files []string
+	for _, f := range []string{r.cfg.CAFile, r.cfg.CertFile, r.cfg.KeyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// load reads the files, keeping the previous certificates when it fails.
+func (r *certReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTLSConfig, err)
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	var roots *x509.CertPool
+	if r.cfg.CAFile != "" {
+		pem, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTLSConfig, err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%w: no certificate in %s", ErrInvalidTLSConfig, r.cfg.CAFile)
+		}
+	}
+
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidTLSConfig, err)
+		}
+		cert = &c
+	}
+
+	r.mu.Lock()
+	r.roots = roots
+	r.cert = cert
+	r.modTimes = modTimes
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+
+	return nil
+}
+
+// reload reads the files again when one of them changed since the last load.
+func (r *certReloader) reload() {
+	r.mu.Lock()
+	if time.Since(r.checkedAt) < r.cfg.ReloadInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.checkedAt = time.Now()
+	modTimes := r.modTimes
+	r.mu.Unlock()
+
+	changed := false
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil || !info.ModTime().Equal(modTimes[f]) {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return
+	}
+
+	log := logger.GetLogger()
+	if err := r.load(); err != nil {
+		log.Err(err).Msg("http client tls certificates reload failed, keeping the previous ones")
+		return
+	}
+	log.Info().Strs("files", r.files()).Msg("http client tls certificates reloaded")
+}
+
+func (r *certReloader) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	r.reload()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+func (r *certReloader) verifyConnection(cs tls.ConnectionState) error {
+	r.reload()
+
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("tls: server sent no certificate")
+	}
+
+	// the SNI is not sent to IP addresses, the name must then come from the config
+	serverName := cs.ServerName
+	if serverName == "" {
+		serverName = r.cfg.ServerName
+	}
+	if serverName == "" {
+		return errors.New("tls: no server name to verify, set the ServerName of the client tls config")
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range cs.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		DNSName:       serverName,
+	})
+	return err
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+func writeServerCA(t *testing.T, path string, server *httptest.Server) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeSelfSignedCA(t *testing.T, path string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	logger.InitLog("test")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeServerCA(t, caFile, server)
+
+	call := func(cfg TLSConfig) error {
+		_, err := NewClient(server.URL, WithTimeout(time.Second), WithTLS(cfg)).R().SetContext(context.Background()).Get("/")
+		return err
+	}
+
+	if err := call(TLSConfig{}); err == nil {
+		t.Fatal("expected the system roots to reject the test server")
+	}
+	if err := call(TLSConfig{InsecureSkipVerifyDevOnly: true}); err != nil {
+		t.Fatalf("insecure mode: %v", err)
+	}
+	if err := call(TLSConfig{CAFile: caFile, ServerName: "example.com"}); err != nil {
+		t.Fatalf("ca bundle: %v", err)
+	}
+	if err := call(TLSConfig{CAFile: caFile, ServerName: "wrong.example"}); err == nil {
+		t.Fatal("expected the server name to be verified")
+	}
+	if _, err := newTLSConfig(TLSConfig{CAFile: caFile, MinVersion: "1.1"}); !errors.Is(err, ErrInvalidTLSConfig) {
+		t.Fatal("expected the min version to be validated")
+	}
+}
+
+func TestTLSConfigReload(t *testing.T) {
+	logger.InitLog("test")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	// httptest servers share their certificate, the bundle starts with another one
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeSelfSignedCA(t, caFile)
+
+	c := NewClient(server.URL, WithTimeout(time.Second),
+		WithTLS(TLSConfig{CAFile: caFile, ServerName: "example.com", ReloadInterval: time.Millisecond}))
+
+	if _, err := c.R().SetContext(context.Background()).Get("/"); err == nil {
+		t.Fatal("expected the certificate of another server to be rejected")
+	}
+
+	writeServerCA(t, caFile, server)
+	future := time.Now().Add(time.Second)
+	if err := os.Chtimes(caFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	c.GetClient().CloseIdleConnections()
+
+	if _, err := c.R().SetContext(context.Background()).Get("/"); err != nil {
+		t.Fatalf("expected the reloaded bundle to be used: %v", err)
+	}
+}
+
+func TestClientTransportSetters(t *testing.T) {
+	logger.InitLog("test")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writeServerCA(t, caFile, server)
+
+	// the transport is wrapped by the timeout round tripper, the setters must still apply
+	c := NewClient(server.URL, WithTimeout(time.Second))
+	c.SetRootCertificate(caFile)
+	if _, err := c.R().SetContext(context.Background()).Get("/"); err != nil {
+		t.Fatalf("root certificate: %v", err)
+	}
+
+	c.SetProxy("http://proxy.internal:3128")
+	transport, err := c.Transport()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.Proxy == nil {
+		t.Fatal("expected the proxy to be set on the transport")
+	}
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	neturl "net/url"
+	"os"
+
+	"github.com/go-resty/resty/v2"
+
+	logger "go-source/pkg/log"
+)
+
+// The transport of the resty client is wrapped by the timeout, cassette and resilience round
+// trippers, so the resty setters that need an *http.Transport would do nothing. The methods
+// below replace them and apply the settings to the underlying *http.Transport.
+
+// Transport returns the *http.Transport under the round trippers of the client.
+func (c *Client) Transport() (*http.Transport, error) {
+	if c.transport == nil {
+		return nil, errors.New("current transport is not an *http.Transport instance")
+	}
+	return c.transport, nil
+}
+
+// SetTLSClientConfig replaces the TLS config of the connections, including the one set by WithTLS.
+func (c *Client) SetTLSClientConfig(config *tls.Config) *resty.Client {
+	if transport, err := c.Transport(); err != nil {
+		c.logTransportError(err, "set tls client config")
+	} else {
+		transport.TLSClientConfig = config
+	}
+	return c.Client
+}
+
+// SetProxy sends the requests through the proxy at proxyURL.
+func (c *Client) SetProxy(proxyURL string) *resty.Client {
+	transport, err := c.Transport()
+	if err != nil {
+		c.logTransportError(err, "set proxy")
+		return c.Client
+	}
+
+	pURL, err := neturl.Parse(proxyURL)
+	if err != nil {
+		c.logTransportError(err, "set proxy")
+		return c.Client
+	}
+	transport.Proxy = http.ProxyURL(pURL)
+	return c.Client
+}
+
+// RemoveProxy sends the requests directly.
+func (c *Client) RemoveProxy() *resty.Client {
+	if transport, err := c.Transport(); err != nil {
+		c.logTransportError(err, "remove proxy")
+	} else {
+		transport.Proxy = nil
+	}
+	return c.Client
+}
+
+// SetCertificates adds client certificates for mTLS.
+func (c *Client) SetCertificates(certs ...tls.Certificate) *resty.Client {
+	if config, err := c.tlsConfig(); err != nil {
+		c.logTransportError(err, "set certificates")
+	} else {
+		config.Certificates = append(config.Certificates, certs...)
+	}
+	return c.Client
+}
+
+// SetRootCertificate adds the root certificates of a PEM file.
+func (c *Client) SetRootCertificate(pemFilePath string) *resty.Client {
+	pem, err := os.ReadFile(pemFilePath)
+	if err != nil {
+		c.logTransportError(err, "set root certificate")
+		return c.Client
+	}
+	return c.SetRootCertificateFromString(string(pem))
+}
+
+// SetRootCertificateFromString adds PEM root certificates.
+func (c *Client) SetRootCertificateFromString(pemCerts string) *resty.Client {
+	config, err := c.tlsConfig()
+	if err != nil {
+		c.logTransportError(err, "set root certificate")
+		return c.Client
+	}
+
+	if config.RootCAs == nil {
+		config.RootCAs = x509.NewCertPool()
+	}
+	config.RootCAs.AppendCertsFromPEM([]byte(pemCerts))
+	return c.Client
+}
+
+func (c *Client) tlsConfig() (*tls.Config, error) {
+	transport, err := c.Transport()
+	if err != nil {
+		return nil, err
+	}
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{}
+	}
+	return transport.TLSClientConfig, nil
+}
+
+func (c *Client) logTransportError(err error, action string) {
+	logger.GetLogger().Err(err).Str("base_url", c.BaseURL).Msgf("http client %s failed", action)
+}
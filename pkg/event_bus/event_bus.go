@@ -2,27 +2,120 @@ package event_bus
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"reflect"
+	"runtime/debug"
 	"sync"
+	"time"
+
+	logger "go-source/pkg/log"
+	"go-source/pkg/metric"
+	"go-source/pkg/utils"
+)
+
+const defaultBufferSize = 10
+
+var (
+	ErrNoSubscriber    = errors.New("no subscriber found")
+	ErrSubscriberFull  = errors.New("subscriber buffer is full")
+	ErrUnsubscribed    = errors.New("subscriber unsubscribed")
+	ErrInvalidResponse = errors.New("response must be a pointer")
+	ErrHandlerPanic    = errors.New("event handler panicked")
+	ErrClosed          = errors.New("event bus closed")
+)
+
+// error codes of the event bus metrics
+const (
+	codeHandler = "HANDLER"
+	codePanic   = "PANIC"
+	codeDropped = "DROPPED"
+	codeFull    = "FULL"
 )
 
-type ErrCallback chan error
-type Subscriber chan *Event
 type HandleEvent func(event *Event) error
 
+// Event is delivered to every subscriber of its type. Subscribers share it, so handlers must
+// not modify Data; with request/reply, Response is filled by the handlers. Type is set by
+// the publish methods.
 type Event struct {
-	Ctx         context.Context
-	Data        interface{}
-	ErrCallback ErrCallback
-	Response    interface{}
+	Type     string
+	Ctx      context.Context
+	Data     interface{}
+	Response interface{}
 }
 
-type EventBus struct {
-	subscriber map[string]Subscriber
+// OverflowPolicy decides what publishing does when a subscriber's buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the buffer, or until the event's context is done.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop skips the subscriber; the event is not handled by it.
+	OverflowDrop
+	// OverflowError skips the subscriber and reports ErrSubscriberFull to the publisher.
+	OverflowError
+)
+
+type SubscribeOption func(sub *Subscription)
+
+// WithBufferSize sets how many events wait for the subscriber. It defaults to 10.
+func WithBufferSize(size int) SubscribeOption {
+	return func(sub *Subscription) {
+		if size >= 0 {
+			sub.bufferSize = size
+		}
+	}
+}
+
+func WithOverflowPolicy(policy OverflowPolicy) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.policy = policy
+	}
+}
+
+// WithMiddleware wraps the handler of the subscriber, inside the middlewares of the bus.
+func WithMiddleware(middlewares ...Middleware) SubscribeOption {
+	return func(sub *Subscription) {
+		sub.middlewares = append(sub.middlewares, middlewares...)
+	}
+}
+
+// Subscription is one handler of an event type, running on its own goroutine.
+type Subscription struct {
+	eventType   string
+	handler     HandleEvent
+	bufferSize  int
+	policy      OverflowPolicy
+	middlewares []Middleware
+
+	deliveries chan delivery
+	done       chan struct{}
+	quit       chan struct{}
+	quitOnce   sync.Once
+	closed     bool
 	mu         sync.RWMutex
 }
 
+// delivery is an event sent to one subscriber. reply is nil for PublishAsync.
+type delivery struct {
+	event *Event
+	reply chan error
+}
+
+type EventBus struct {
+	subscribers map[string][]*Subscription
+	middlewares []Middleware
+	closed      bool
+	mu          sync.RWMutex
+
+	// instanceID marks the events this instance forwards, so that they are not delivered twice.
+	instanceID string
+	transport  Transport
+	// remoteTypes holds the Data type of each event type forwarded to the other instances.
+	remoteTypes map[string]reflect.Type
+}
+
 var (
 	eventBus *EventBus
 	once     sync.Once
@@ -30,90 +123,315 @@ var (
 
 func NewEventBus() *EventBus {
 	once.Do(func() {
-		eventBus = &EventBus{
-			subscriber: make(map[string]Subscriber),
-		}
+		eventBus = newEventBus()
 	})
 	return eventBus
 }
 
+func newEventBus() *EventBus {
+	return &EventBus{
+		subscribers: make(map[string][]*Subscription),
+		instanceID:  utils.GenerateID(),
+		transport:   MemoryTransport{},
+		remoteTypes: make(map[string]reflect.Type),
+	}
+}
+
 func GetEventBus() *EventBus {
 	return eventBus
 }
 
-func (eb *EventBus) Subscribe(eventType string, fn HandleEvent) {
+// Use adds middlewares to the handlers of the subscribers subscribed afterwards. The first
+// one is the outermost.
+func (eb *EventBus) Use(middlewares ...Middleware) {
+	eb.mu.Lock()
+	eb.middlewares = append(eb.middlewares, middlewares...)
+	eb.mu.Unlock()
+}
+
+// Subscribe adds fn to the handlers of eventType. Every subscriber receives every event.
+// Nothing is subscribed once the bus is closed.
+func (eb *EventBus) Subscribe(eventType string, fn HandleEvent, opts ...SubscribeOption) *Subscription {
+	sub := &Subscription{
+		eventType:  eventType,
+		bufferSize: defaultBufferSize,
+		policy:     OverflowBlock,
+		done:       make(chan struct{}),
+		quit:       make(chan struct{}),
+	}
+	for _, o := range opts {
+		o(sub)
+	}
+	sub.deliveries = make(chan delivery, sub.bufferSize)
+
 	eb.mu.Lock()
 	defer eb.mu.Unlock()
-	if _, ok := eb.subscriber[eventType]; !ok {
-		eb.subscriber[eventType] = make(Subscriber, 10)
+
+	middlewares := append(append([]Middleware(nil), eb.middlewares...), sub.middlewares...)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		fn = middlewares[i](fn)
 	}
+	sub.handler = fn
 
-	sub := eb.subscriber[eventType]
+	if eb.closed {
+		sub.close()
+		close(sub.done)
+		return sub
+	}
 
-	go func(sub Subscriber) {
-		for event := range sub {
-			select {
-			case <-event.Ctx.Done():
-			default:
-				sendErr(event.ErrCallback, fn(event))
-			}
+	eb.subscribers[eventType] = append(eb.subscribers[eventType], sub)
+	go sub.run()
+
+	return sub
+}
+
+// Unsubscribe removes sub. Events already in its buffer are still handled.
+func (eb *EventBus) Unsubscribe(sub *Subscription) {
+	eb.mu.Lock()
+	subs := eb.subscribers[sub.eventType]
+	for i, s := range subs {
+		if s == sub {
+			eb.subscribers[sub.eventType] = append(subs[:i:i], subs[i+1:]...)
+			break
 		}
-	}(sub)
+	}
+	if len(eb.subscribers[sub.eventType]) == 0 {
+		delete(eb.subscribers, sub.eventType)
+	}
+	eb.mu.Unlock()
+
+	sub.close()
 }
 
+// Publish delivers event to every subscriber of eventType and waits for all of them. The
+// errors of every handler, and of the subscribers that could not receive the event, are
+// combined. Remote event types are also forwarded to the other instances, whose handlers
+// are not waited for.
 func (eb *EventBus) Publish(eventType string, event *Event) error {
-	if event.ErrCallback == nil {
-		event.ErrCallback = make(ErrCallback)
+	event.Type = eventType
+	if event.Ctx == nil {
+		event.Ctx = context.Background()
 	}
 
-	if event.Response != nil {
-		v := reflect.ValueOf(event.Response)
-		if v.Kind() != reflect.Ptr {
-			close(event.ErrCallback)
-			return fmt.Errorf("response must be a pointer")
-		}
+	if event.Response != nil && reflect.ValueOf(event.Response).Kind() != reflect.Ptr {
+		return ErrInvalidResponse
 	}
 
-	if err := eb.publish(eventType, event); err != nil {
-		return err
+	forwarded, sendErr := eb.forward(event)
+	err := eb.publishLocal(event, true)
+	if forwarded && errors.Is(err, ErrNoSubscriber) {
+		err = nil
 	}
 
-	defer close(event.ErrCallback)
+	return errors.Join(sendErr, err)
+}
 
-	// Wait for the ErrCallback
-	select {
-	case <-event.Ctx.Done():
-		return fmt.Errorf("%w: no ErrCallback received", event.Ctx.Err())
-	case err := <-event.ErrCallback:
+// PublishAsync delivers event to every subscriber of eventType without waiting for the handlers.
+// It only reports the subscribers that could not receive the event.
+func (eb *EventBus) PublishAsync(eventType string, event *Event) error {
+	event.Type = eventType
+	if event.Ctx == nil {
+		event.Ctx = context.Background()
+	}
+
+	forwarded, sendErr := eb.forward(event)
+	err := eb.publishLocal(event, false)
+	if forwarded && errors.Is(err, ErrNoSubscriber) {
+		err = nil
+	}
+
+	return errors.Join(sendErr, err)
+}
+
+// publishLocal delivers event to the subscribers of this instance, waiting for their
+// handlers when wait is set.
+func (eb *EventBus) publishLocal(event *Event, wait bool) error {
+	subs, err := eb.subscribersOf(event.Type)
+	if err != nil {
 		return err
 	}
+
+	var reply chan error
+	if wait {
+		reply = make(chan error, len(subs))
+	}
+
+	var errs []error
+	waiting := 0
+	for _, sub := range subs {
+		sent, err := sub.send(delivery{event: event, reply: reply})
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if sent && wait {
+			waiting++
+		}
+	}
+
+	for ; waiting > 0; waiting-- {
+		select {
+		case <-event.Ctx.Done():
+			errs = append(errs, fmt.Errorf("%w: %d handlers did not reply", event.Ctx.Err(), waiting))
+			return errors.Join(errs...)
+		case err := <-reply:
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
 }
 
-func (eb *EventBus) publish(eventType string, event *Event) error {
+func (eb *EventBus) subscribersOf(eventType string) ([]*Subscription, error) {
 	eb.mu.RLock()
 	defer eb.mu.RUnlock()
 
-	sub, ok := eb.subscriber[eventType]
-	if !ok {
-		return fmt.Errorf("no subscriber found for event type %s", eventType)
+	if eb.closed {
+		return nil, ErrClosed
+	}
+
+	subs := eb.subscribers[eventType]
+	if len(subs) == 0 {
+		return nil, fmt.Errorf("%w: event type %s", ErrNoSubscriber, eventType)
+	}
+
+	return append([]*Subscription(nil), subs...), nil
+}
+
+// Close stops the transport, stops accepting events and unsubscribes everyone, then waits
+// until the events already queued are handled or ctx is done.
+func (eb *EventBus) Close(ctx context.Context) error {
+	eb.mu.RLock()
+	transport := eb.transport
+	eb.mu.RUnlock()
+
+	if err := transport.Close(ctx); err != nil {
+		logger.GetLogger().Err(err).Msg("event bus transport close failed")
+	}
+
+	eb.mu.Lock()
+	eb.closed = true
+	var subs []*Subscription
+	for _, s := range eb.subscribers {
+		subs = append(subs, s...)
 	}
+	eb.subscribers = make(map[string][]*Subscription)
+	eb.mu.Unlock()
 
-	// Publish event to subscriber
-	sub <- event
+	for _, sub := range subs {
+		sub.close()
+	}
+
+	for _, sub := range subs {
+		select {
+		case <-sub.done:
+		case <-ctx.Done():
+			return fmt.Errorf("event bus drain: %w", ctx.Err())
+		}
+	}
 
 	return nil
 }
 
-// Safe function to send errors into ErrCallback, checks if channel is open
-func sendErr(ch ErrCallback, err error) {
+// send hands d to the subscriber following its overflow policy, and reports whether it did.
+func (sub *Subscription) send(d delivery) (bool, error) {
+	sub.mu.RLock()
+	defer sub.mu.RUnlock()
+
+	if sub.closed {
+		return false, nil
+	}
+
+	select {
+	case sub.deliveries <- d:
+		metric.AddEventBusQueueDepth(sub.eventType, 1)
+		return true, nil
+	default:
+	}
+
+	switch sub.policy {
+	case OverflowDrop:
+		metric.RecordEventBusError(sub.eventType, codeDropped)
+		logger.GetLogger().AddTraceInfoContextRequest(d.event.Ctx).Warn().
+			Str("event_type", sub.eventType).
+			Msg("event bus subscriber full, event dropped")
+		return false, nil
+	case OverflowError:
+		metric.RecordEventBusError(sub.eventType, codeFull)
+		return false, fmt.Errorf("%w: event type %s", ErrSubscriberFull, sub.eventType)
+	}
+
+	select {
+	case sub.deliveries <- d:
+		metric.AddEventBusQueueDepth(sub.eventType, 1)
+		return true, nil
+	case <-sub.quit:
+		return false, fmt.Errorf("%w: event type %s", ErrUnsubscribed, sub.eventType)
+	case <-d.event.Ctx.Done():
+		return false, d.event.Ctx.Err()
+	}
+}
+
+func (sub *Subscription) run() {
+	defer close(sub.done)
+
+	for d := range sub.deliveries {
+		metric.AddEventBusQueueDepth(sub.eventType, -1)
+
+		var err error
+		select {
+		case <-d.event.Ctx.Done():
+			err = d.event.Ctx.Err()
+		default:
+			err = sub.handle(d.event)
+		}
+
+		if d.reply != nil {
+			d.reply <- err
+		}
+	}
+}
+
+// handle runs the handler, turning a panic into an ErrHandlerPanic error.
+func (sub *Subscription) handle(event *Event) (err error) {
+	start := time.Now()
+	code := "SUCCESS"
+
 	defer func() {
 		if r := recover(); r != nil {
-			fmt.Printf("Recovered from panic: %v\n", r)
+			logger.GetLogger().AddTraceInfoContextRequest(event.Ctx).Error().
+				Str("event_type", sub.eventType).
+				Str("stack", string(debug.Stack())).
+				Msgf("event bus handler panic: %v", r)
+			err = fmt.Errorf("%w: %v", ErrHandlerPanic, r)
+			code = codePanic
+		}
+
+		if code != "SUCCESS" {
+			metric.RecordEventBusError(sub.eventType, code)
 		}
+		metric.NewEventBusHandlerHistogramDuration(sub.eventType, code, time.Since(start))
 	}()
-	select {
-	case ch <- err:
-	default:
-		// If channel is already closed or no receivers, ignore
+
+	if err = sub.handler(event); err != nil {
+		code = codeHandler
+	}
+
+	return err
+}
+
+// close stops new deliveries. Blocked publishers are released first, so that the lock is free.
+func (sub *Subscription) close() {
+	sub.quitOnce.Do(func() {
+		close(sub.quit)
+	})
+
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if !sub.closed {
+		sub.closed = true
+		close(sub.deliveries)
 	}
 }
@@ -0,0 +1,201 @@
+package event_bus
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+func TestEventBus_FanOut(t *testing.T) {
+	eb := newEventBus()
+
+	var calls atomic.Int32
+	errFirst := errors.New("first failed")
+	first := eb.Subscribe("fan-out", func(event *Event) error {
+		calls.Add(1)
+		return errFirst
+	})
+	eb.Subscribe("fan-out", func(event *Event) error {
+		calls.Add(1)
+		return nil
+	})
+
+	if err := eb.Publish("fan-out", &Event{Data: 1}); !errors.Is(err, errFirst) {
+		t.Fatalf("Publish() error = %v, want %v", err, errFirst)
+	}
+	if calls.Load() != 2 {
+		t.Fatalf("calls = %d, want every subscriber called", calls.Load())
+	}
+
+	eb.Unsubscribe(first)
+	if err := eb.Publish("fan-out", &Event{Data: 2}); err != nil {
+		t.Fatalf("Publish() error = %v after unsubscribing the failing handler", err)
+	}
+
+	if err := eb.Publish("nobody", &Event{}); !errors.Is(err, ErrNoSubscriber) {
+		t.Fatalf("Publish() error = %v, want ErrNoSubscriber", err)
+	}
+}
+
+func TestEventBus_OverflowPolicies(t *testing.T) {
+	logger.InitLog("event-bus-test")
+	eb := newEventBus()
+
+	started := make(chan struct{}, 4)
+	release := make(chan struct{})
+	var handled atomic.Int32
+	slow := func(event *Event) error {
+		started <- struct{}{}
+		<-release
+		handled.Add(1)
+		return nil
+	}
+	eb.Subscribe("overflow-error", slow, WithBufferSize(1), WithOverflowPolicy(OverflowError))
+	eb.Subscribe("overflow-drop", slow, WithBufferSize(1), WithOverflowPolicy(OverflowDrop))
+
+	// the first event occupies each handler, the second fills the buffer, the third finds no room
+	for _, eventType := range []string{"overflow-error", "overflow-drop"} {
+		if err := eb.PublishAsync(eventType, &Event{}); err != nil {
+			t.Fatalf("PublishAsync(%s) error = %v", eventType, err)
+		}
+		<-started
+		if err := eb.PublishAsync(eventType, &Event{}); err != nil {
+			t.Fatalf("PublishAsync(%s) error = %v", eventType, err)
+		}
+	}
+
+	if err := eb.PublishAsync("overflow-error", &Event{}); !errors.Is(err, ErrSubscriberFull) {
+		t.Fatalf("PublishAsync() error = %v, want ErrSubscriberFull", err)
+	}
+	if err := eb.PublishAsync("overflow-drop", &Event{}); err != nil {
+		t.Fatalf("PublishAsync() error = %v, want the event dropped", err)
+	}
+	if err := eb.Publish("overflow-error", &Event{}); !errors.Is(err, ErrSubscriberFull) {
+		t.Fatalf("Publish() error = %v, want ErrSubscriberFull", err)
+	}
+
+	// Close returns once the queued events are handled
+	close(release)
+	if err := eb.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if handled.Load() != 4 {
+		t.Fatalf("handled = %d, want only the first two events of each subscriber", handled.Load())
+	}
+}
+
+func TestEventBus_CloseDrainsAndRecovers(t *testing.T) {
+	logger.InitLog("event-bus-test")
+	eb := newEventBus()
+
+	var handled atomic.Int32
+	eb.Subscribe("drain", func(event *Event) error {
+		time.Sleep(10 * time.Millisecond)
+		handled.Add(1)
+		return nil
+	})
+	eb.Subscribe("panic", func(event *Event) error {
+		panic("boom")
+	}, WithMiddleware(Logging))
+
+	if err := eb.Publish("panic", &Event{}); !errors.Is(err, ErrHandlerPanic) {
+		t.Fatalf("Publish() error = %v, want ErrHandlerPanic", err)
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := eb.PublishAsync("drain", &Event{}); err != nil {
+			t.Fatalf("PublishAsync() error = %v", err)
+		}
+	}
+
+	if err := eb.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if handled.Load() != 5 {
+		t.Fatalf("handled = %d, want every queued event handled before Close returns", handled.Load())
+	}
+	if err := eb.PublishAsync("drain", &Event{}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("PublishAsync() error = %v, want ErrClosed", err)
+	}
+}
+
+// loopTransport hands every sent event to all the buses started on it, like a pub/sub channel.
+type loopTransport struct {
+	receivers *[]func(data []byte)
+}
+
+func (t loopTransport) Send(ctx context.Context, data []byte) error {
+	for _, receive := range *t.receivers {
+		receive(data)
+	}
+	return nil
+}
+
+func (t loopTransport) Start(ctx context.Context, receive func(data []byte)) error {
+	*t.receivers = append(*t.receivers, receive)
+	return nil
+}
+
+func (t loopTransport) Close(ctx context.Context) error {
+	return nil
+}
+
+type cacheInvalidated struct {
+	Key string `json:"key"`
+}
+
+func TestEventBus_RemoteTransport(t *testing.T) {
+	logger.InitLog("event-bus-test")
+	transport := loopTransport{receivers: &[]func(data []byte){}}
+
+	received := make(chan interface{}, 4)
+	buses := []*EventBus{newEventBus(), newEventBus()}
+	for _, eb := range buses {
+		eb.RegisterRemote("cache.invalidated", cacheInvalidated{})
+		if err := eb.SetTransport(context.Background(), transport); err != nil {
+			t.Fatalf("SetTransport() error = %v", err)
+		}
+		eb.Subscribe("cache.invalidated", func(event *Event) error {
+			received <- event.Data
+			return nil
+		})
+	}
+
+	if err := buses[0].Publish("cache.invalidated", &Event{Data: cacheInvalidated{Key: "user:1"}}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case data := <-received:
+			if data != (cacheInvalidated{Key: "user:1"}) {
+				t.Fatalf("Data = %#v, want the decoded cacheInvalidated", data)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("received %d events, want one per instance", i)
+		}
+	}
+
+	select {
+	case data := <-received:
+		t.Fatalf("received %#v, want the publisher's own event suppressed", data)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestRedisTransport_ClosedIsNotStarted(t *testing.T) {
+	transport := NewRedisTransport(nil, "events")
+
+	for i := 0; i < 2; i++ {
+		if err := transport.Close(context.Background()); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+	if err := transport.Start(context.Background(), func(data []byte) {}); !errors.Is(err, ErrTransportStarted) {
+		t.Fatalf("Start() error = %v, want ErrTransportStarted", err)
+	}
+}
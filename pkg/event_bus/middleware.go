@@ -0,0 +1,30 @@
+package event_bus
+
+import (
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+// Middleware wraps a HandleEvent, the same way echo middlewares wrap echo handlers.
+type Middleware func(next HandleEvent) HandleEvent
+
+// Logging logs every handled event with the trace info of event.Ctx.
+func Logging(next HandleEvent) HandleEvent {
+	return func(event *Event) error {
+		start := time.Now()
+		err := next(event)
+
+		log := logger.GetLogger().AddTraceInfoContextRequest(event.Ctx)
+		logEvent := log.Info()
+		if err != nil {
+			logEvent = log.Error().Err(err)
+		}
+		logEvent.
+			Str("event_type", event.Type).
+			Dur("duration", time.Since(start)).
+			Msg("event bus event handled")
+
+		return err
+	}
+}
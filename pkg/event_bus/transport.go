@@ -0,0 +1,167 @@
+package event_bus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"go.opentelemetry.io/otel/propagation"
+
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+)
+
+// ErrTransportStarted is returned by the Start of a transport that was already started or closed.
+var ErrTransportStarted = errors.New("event bus transport already started")
+
+// Transport carries remote events between the instances sharing it.
+type Transport interface {
+	// Send forwards an encoded event to every instance, this one included.
+	Send(ctx context.Context, data []byte) error
+	// Start hands the events sent by every instance to receive until Close is called. A
+	// transport is started once.
+	Start(ctx context.Context, receive func(data []byte)) error
+	Close(ctx context.Context) error
+}
+
+// MemoryTransport keeps events inside the process. It is the default transport.
+type MemoryTransport struct{}
+
+func (MemoryTransport) Send(ctx context.Context, data []byte) error {
+	return nil
+}
+
+func (MemoryTransport) Start(ctx context.Context, receive func(data []byte)) error {
+	return nil
+}
+
+func (MemoryTransport) Close(ctx context.Context) error {
+	return nil
+}
+
+// remoteEvent is the encoded form of an event sent through a transport.
+type remoteEvent struct {
+	InstanceID   string            `json:"instanceId"`
+	Type         string            `json:"type"`
+	TraceInfo    *utils.TraceInfo  `json:"traceInfo,omitempty"`
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+	Data         json.RawMessage   `json:"data"`
+}
+
+// InstanceID identifies this instance in the events it forwards.
+func (eb *EventBus) InstanceID() string {
+	return eb.instanceID
+}
+
+// RegisterRemote forwards the events of eventType to the other instances through the
+// transport. Their Data is encoded as JSON and decoded into a new value of the type of data,
+// e.g. RegisterRemote("cache.invalidated", CacheInvalidated{}).
+func (eb *EventBus) RegisterRemote(eventType string, data interface{}) {
+	eb.mu.Lock()
+	eb.remoteTypes[eventType] = reflect.TypeOf(data)
+	eb.mu.Unlock()
+}
+
+// SetTransport replaces the transport, closing the previous one, and starts receiving the
+// events of the other instances.
+func (eb *EventBus) SetTransport(ctx context.Context, transport Transport) error {
+	eb.mu.Lock()
+	previous := eb.transport
+	eb.transport = transport
+	eb.mu.Unlock()
+
+	if err := previous.Close(ctx); err != nil {
+		logger.GetLogger().Err(err).Msg("event bus transport close failed")
+	}
+
+	return transport.Start(ctx, eb.receive)
+}
+
+// forward sends a remote event type through the transport and reports whether it did.
+func (eb *EventBus) forward(event *Event) (bool, error) {
+	eb.mu.RLock()
+	_, remote := eb.remoteTypes[event.Type]
+	transport := eb.transport
+	eb.mu.RUnlock()
+
+	if _, local := transport.(MemoryTransport); !remote || local {
+		return false, nil
+	}
+
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		return false, fmt.Errorf("event bus encode %s: %w", event.Type, err)
+	}
+
+	traceContext := propagation.MapCarrier{}
+	utils.InjectTraceContext(event.Ctx, traceContext)
+
+	msg, err := json.Marshal(remoteEvent{
+		InstanceID:   eb.instanceID,
+		Type:         event.Type,
+		TraceInfo:    utils.GetRequestIdByContext(event.Ctx),
+		TraceContext: traceContext,
+		Data:         data,
+	})
+	if err != nil {
+		return false, fmt.Errorf("event bus encode %s: %w", event.Type, err)
+	}
+
+	if err = transport.Send(event.Ctx, msg); err != nil {
+		return false, fmt.Errorf("event bus forward %s: %w", event.Type, err)
+	}
+
+	return true, nil
+}
+
+// receive delivers an event of another instance to the local subscribers, without waiting
+// for them. Events forwarded by this instance were already delivered and are skipped.
+func (eb *EventBus) receive(data []byte) {
+	log := logger.GetLogger()
+
+	var msg remoteEvent
+	if err := json.Unmarshal(data, &msg); err != nil {
+		log.Err(err).Msg("event bus decode remote event failed")
+		return
+	}
+	if msg.InstanceID == eb.instanceID {
+		return
+	}
+
+	eb.mu.RLock()
+	typ, ok := eb.remoteTypes[msg.Type]
+	eb.mu.RUnlock()
+	if !ok {
+		log.Warn().Str("event_type", msg.Type).Msg("event bus remote event type not registered")
+		return
+	}
+
+	ctx := context.Background()
+	if msg.TraceInfo != nil {
+		ctx = context.WithValue(ctx, utils.KeyTraceInfo, *msg.TraceInfo)
+	} else {
+		ctx, _ = utils.NewContextWithRequestId(ctx)
+	}
+	ctx = utils.ExtractTraceContext(ctx, propagation.MapCarrier(msg.TraceContext))
+	log = logger.GetLogger().AddTraceInfoContextRequest(ctx)
+
+	var value interface{}
+	if typ != nil {
+		ptr := reflect.New(typ)
+		if err := json.Unmarshal(msg.Data, ptr.Interface()); err != nil {
+			log.Err(err).Str("event_type", msg.Type).Msg("event bus decode remote event data failed")
+			return
+		}
+		value = ptr.Elem().Interface()
+	} else if err := json.Unmarshal(msg.Data, &value); err != nil {
+		log.Err(err).Str("event_type", msg.Type).Msg("event bus decode remote event data failed")
+		return
+	}
+
+	err := eb.publishLocal(&Event{Type: msg.Type, Ctx: ctx, Data: value}, false)
+	if err != nil && !errors.Is(err, ErrNoSubscriber) {
+		log.Err(err).Str("event_type", msg.Type).Msg("event bus deliver remote event failed")
+	}
+}
@@ -0,0 +1,108 @@
+package event_bus
+
+import (
+	"context"
+	"os"
+	"sync"
+
+	logger "go-source/pkg/log"
+	"go-source/pkg/queue/kafka"
+	"go-source/pkg/utils"
+)
+
+// KafkaTransport forwards events through a kafka topic. Every instance reads the topic in a
+// consumer group of its own, so that each of them receives every event.
+type KafkaTransport struct {
+	producer *kafka.Producer
+	consumer *kafka.Consumer
+	started  bool
+	mu       sync.Mutex
+}
+
+type kafkaTransportOptions struct {
+	instanceID string
+}
+
+type KafkaTransportOption func(o *kafkaTransportOptions)
+
+// WithInstanceID sets the stable ID of the instance in its consumer group. It defaults to the
+// hostname, which is the pod name on Kubernetes.
+func WithInstanceID(id string) KafkaTransportOption {
+	return func(o *kafkaTransportOptions) {
+		if id != "" {
+			o.instanceID = id
+		}
+	}
+}
+
+// NewKafkaTransport uses the consumer group "<cfg.GroupID>-<instance id>", so that a restarted
+// instance resumes its own group. A new group starts at the latest offset, as the events sent
+// before the instance first started are not delivered.
+//
+// The groups of instances that are gone for good, e.g. replaced pods, are not deleted: the
+// broker removes them once their offsets expire, after offsets.retention.minutes (7 days by
+// default). Give the instances stable IDs, with WithInstanceID or stable hostnames, to keep
+// their number bounded.
+func NewKafkaTransport(cfg kafka.KafkaConfig, topic string, opts ...KafkaTransportOption) *KafkaTransport {
+	o := kafkaTransportOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.instanceID == "" {
+		o.instanceID = defaultInstanceID()
+	}
+
+	cfg.GroupID = cfg.GroupID + "-" + o.instanceID
+	cfg.AutoOffsetReset = "latest"
+	cfg.WorkerLanes = 0
+
+	return &KafkaTransport{
+		producer: kafka.NewProducer(cfg, topic),
+		consumer: kafka.NewConsumer(cfg, []string{topic}),
+	}
+}
+
+// defaultInstanceID is the hostname, or a random ID when it is unknown.
+func defaultInstanceID() string {
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		return hostname
+	}
+	return utils.GenerateID()
+}
+
+func (t *KafkaTransport) Send(ctx context.Context, data []byte) error {
+	return t.producer.PublishBytes(ctx, nil, data)
+}
+
+func (t *KafkaTransport) Start(ctx context.Context, receive func(data []byte)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		return ErrTransportStarted
+	}
+	t.started = true
+
+	t.consumer.OnEvent(func(ctx context.Context, key, value []byte) error {
+		receive(value)
+		return nil
+	})
+
+	go func() {
+		if err := t.consumer.Start(context.WithoutCancel(ctx)); err != nil {
+			logger.GetLogger().Err(err).Msg("event bus kafka transport stopped")
+		}
+	}()
+
+	return nil
+}
+
+// Close stops the consumer and flushes the producer. It may be called more than once.
+func (t *KafkaTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	t.started = true
+	t.mu.Unlock()
+
+	t.consumer.Shutdown(ctx)
+	return t.producer.Close(ctx)
+}
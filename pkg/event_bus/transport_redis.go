@@ -0,0 +1,92 @@
+package event_bus
+
+import (
+	"context"
+	"sync"
+
+	goredis "github.com/redis/go-redis/v9"
+
+	"go-source/pkg/database/redis"
+)
+
+// RedisTransport forwards events through a Redis pub/sub channel. Instances only receive
+// the events sent while they are subscribed.
+type RedisTransport struct {
+	client    *redis.Client
+	channel   string
+	pubsub    *goredis.PubSub
+	started   bool
+	done      chan struct{}
+	closeOnce sync.Once
+	mu        sync.Mutex
+}
+
+func NewRedisTransport(client *redis.Client, channel string) *RedisTransport {
+	return &RedisTransport{
+		client:  client,
+		channel: channel,
+		done:    make(chan struct{}),
+	}
+}
+
+func (t *RedisTransport) Send(ctx context.Context, data []byte) error {
+	return t.client.GetClient().Publish(ctx, t.channel, data).Err()
+}
+
+// Start subscribes to the channel. It may be called again after it failed, not after it
+// succeeded or after Close.
+func (t *RedisTransport) Start(ctx context.Context, receive func(data []byte)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.started {
+		return ErrTransportStarted
+	}
+
+	pubsub := t.client.GetClient().Subscribe(ctx, t.channel)
+	// wait for the subscription, so that no event sent after Start is missed
+	if _, err := pubsub.Receive(ctx); err != nil {
+		_ = pubsub.Close()
+		return err
+	}
+
+	t.started = true
+	t.pubsub = pubsub
+
+	go func() {
+		defer close(t.done)
+		for msg := range pubsub.Channel() {
+			receive([]byte(msg.Payload))
+		}
+	}()
+
+	return nil
+}
+
+// Close unsubscribes and waits until the received events are handed over or ctx is done.
+func (t *RedisTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+	pubsub := t.pubsub
+	// a transport closed before being started is never started
+	t.started = true
+	t.mu.Unlock()
+
+	if pubsub == nil {
+		return nil
+	}
+
+	var err error
+	t.closeOnce.Do(func() {
+		err = pubsub.Close()
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
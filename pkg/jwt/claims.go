@@ -0,0 +1,89 @@
+package jwt
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	ClaimIssuer    = "iss"
+	ClaimSubject   = "sub"
+	ClaimAudience  = "aud"
+	ClaimExpiresAt = "exp"
+	ClaimNotBefore = "nbf"
+	ClaimIssuedAt  = "iat"
+	ClaimID        = "jti"
+	// ClaimFamilyID is the id shared by the tokens issued from the same refresh token chain.
+	ClaimFamilyID = "fid"
+	// ClaimTokenType is set to TokenTypeRefresh in the refresh tokens, that are rejected as
+	// access tokens. Any other value is accepted in an access token.
+	ClaimTokenType = "typ"
+
+	TokenTypeRefresh = "refresh"
+)
+
+// StandardClaims are the registered claims of RFC 7519, embedded in the claims of a service:
+//
+//	type Claims struct {
+//		jwt.StandardClaims
+//		Roles []string `json:"roles"`
+//	}
+type StandardClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+	FamilyID  string   `json:"fid,omitempty"`
+	TokenType string   `json:"typ,omitempty"`
+}
+
+// ExpiresAtTime returns the exp claim as a time, zero when it is not set.
+func (c StandardClaims) ExpiresAtTime() time.Time {
+	if c.ExpiresAt == 0 {
+		return time.Time{}
+	}
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+// Audience is the aud claim, a string or an array of strings.
+type Audience []string
+
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*a = nil
+		return nil
+	}
+
+	var aud string
+	if err := json.Unmarshal(data, &aud); err == nil {
+		*a = Audience{aud}
+		return nil
+	}
+
+	var auds []string
+	if err := json.Unmarshal(data, &auds); err != nil {
+		return err
+	}
+	*a = auds
+	return nil
+}
+
+// Contains reports whether aud is one of the audiences.
+func (a Audience) Contains(aud string) bool {
+	for _, v := range a {
+		if v == aud {
+			return true
+		}
+	}
+	return false
+}
@@ -5,6 +5,10 @@ import "time"
 type JwtConfig struct {
 	Alg        string        `env:"ALG,required,notEmpty"` // support: RS256, RS384, RS512, ES256, ES384, ES512, PS256, PS384, PS512
 	PrivateKey string        `env:"PRIVATE_KEY,required,notEmpty"`
+	Kid        string        `env:"KID"` // set in the header of the tokens when not empty
 	Expire     time.Duration `env:"EXPIRE"`
 	RefExpire  time.Duration `env:"REF_EXPIRE"`
+	// Issuer and Audience are the iss and aud claims set by an Issuer.
+	Issuer   string   `env:"ISSUER"`
+	Audience []string `env:"AUDIENCE" envSeparator:","`
 }
@@ -0,0 +1,257 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-source/pkg/utils"
+)
+
+const (
+	defaultExpire    = 15 * time.Minute
+	defaultRefExpire = 7 * 24 * time.Hour
+)
+
+var (
+	// ErrTokenReused is returned for a refresh token used twice. Its family is revoked: the
+	// token was stolen, either by the caller or by the one who used it first.
+	ErrTokenReused  = errors.New("jwt refresh token reused")
+	ErrNoTokenStore = errors.New("jwt issuer has no token store")
+)
+
+// Signer signs the tokens and verifies the ones it signed: a JWT or a KeySet.
+type Signer interface {
+	KeyProvider
+	SignToken(claims interface{}) (string, error)
+}
+
+// TokenPair is an access token and the refresh token issuing the next pair.
+type TokenPair struct {
+	AccessToken      string    `json:"accessToken"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+type IssuerOption func(i *Issuer)
+
+// WithIssuerTokenStore enables the refresh tokens and the revocation.
+func WithIssuerTokenStore(store TokenStore) IssuerOption {
+	return func(i *Issuer) {
+		i.store = store
+	}
+}
+
+// WithIssuerClockSkew tolerates a clock skew when verifying the refresh tokens.
+func WithIssuerClockSkew(skew time.Duration) IssuerOption {
+	return func(i *Issuer) {
+		i.clockSkew = skew
+	}
+}
+
+// Issuer signs tokens with the standard claims of the config: iss, aud, iat, nbf, exp of
+// Expire (or RefExpire for the refresh tokens) and a unique jti.
+//
+// Refresh tokens are rotated: a refresh token issues one pair, and a second use of it revokes
+// every token of its family, the tokens issued since the first pair.
+type Issuer struct {
+	signer    Signer
+	cfg       JwtConfig
+	store     TokenStore
+	clockSkew time.Duration
+}
+
+func NewIssuer(signer Signer, cfg JwtConfig, opts ...IssuerOption) *Issuer {
+	if cfg.Expire <= 0 {
+		cfg.Expire = defaultExpire
+	}
+	if cfg.RefExpire <= 0 {
+		cfg.RefExpire = defaultRefExpire
+	}
+
+	i := &Issuer{signer: signer, cfg: cfg}
+	for _, opt := range opts {
+		opt(i)
+	}
+
+	return i
+}
+
+// Verifier returns a verifier of the access tokens of the issuer.
+func (i *Issuer) Verifier(opts ...VerifierOption) *Verifier {
+	return NewVerifier(i.signer, append(i.verifierOptions(), opts...)...)
+}
+
+func (i *Issuer) verifierOptions() []VerifierOption {
+	opts := []VerifierOption{WithIssuer(i.cfg.Issuer), WithClockSkew(i.clockSkew)}
+	if len(i.cfg.Audience) > 0 {
+		opts = append(opts, WithAudience(i.cfg.Audience[0]))
+	}
+	if i.store != nil {
+		opts = append(opts, WithTokenStore(i.store))
+	}
+	return opts
+}
+
+// Issue signs an access token of claims. The standard claims set in claims are kept.
+func (i *Issuer) Issue(claims interface{}) (string, error) {
+	mapClaims, err := toMapClaims(claims)
+	if err != nil {
+		return "", err
+	}
+
+	token, _, err := i.sign(mapClaims, "", i.cfg.Expire)
+	return token, err
+}
+
+// IssuePair signs an access token and a refresh token of claims, starting a new family.
+func (i *Issuer) IssuePair(ctx context.Context, claims interface{}) (TokenPair, error) {
+	if i.store == nil {
+		return TokenPair{}, ErrNoTokenStore
+	}
+
+	mapClaims, err := toMapClaims(claims)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	mapClaims[ClaimFamilyID] = utils.GenerateID()
+
+	return i.issuePair(mapClaims)
+}
+
+// Refresh uses refreshToken to issue the next pair, with the claims of refreshToken.
+func (i *Issuer) Refresh(ctx context.Context, refreshToken string) (TokenPair, error) {
+	if i.store == nil {
+		return TokenPair{}, ErrNoTokenStore
+	}
+
+	verifier := NewVerifier(i.signer, i.verifierOptions()...)
+	mapClaims, std, err := verifier.verify(ctx, refreshToken, TokenTypeRefresh)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	first, err := i.store.Use(ctx, std.ID, std.ExpiresAtTime())
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if !first {
+		if err = i.store.Revoke(ctx, std.FamilyID, i.familyExpiresAt()); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, fmt.Errorf("%w: family %s revoked", ErrTokenReused, std.FamilyID)
+	}
+
+	for _, claim := range []string{ClaimExpiresAt, ClaimNotBefore, ClaimIssuedAt, ClaimID, ClaimTokenType} {
+		delete(mapClaims, claim)
+	}
+
+	return i.issuePair(mapClaims)
+}
+
+// Revoke verifies tokenStr, an access or a refresh token, and revokes its family, or itself
+// when it has none.
+func (i *Issuer) Revoke(ctx context.Context, tokenStr string) error {
+	if i.store == nil {
+		return ErrNoTokenStore
+	}
+
+	var std StandardClaims
+	mapClaims, err := parseWithKeys(ctx, i.signer, tokenStr)
+	if err != nil {
+		return err
+	}
+	if err = decodeClaims(mapClaims, &std); err != nil {
+		return err
+	}
+
+	if std.FamilyID != "" {
+		return i.store.Revoke(ctx, std.FamilyID, i.familyExpiresAt())
+	}
+	return i.store.Revoke(ctx, std.ID, std.ExpiresAtTime())
+}
+
+func (i *Issuer) issuePair(mapClaims map[string]interface{}) (TokenPair, error) {
+	accessToken, expiresAt, err := i.sign(copyClaims(mapClaims), "", i.cfg.Expire)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	refreshToken, refreshExpiresAt, err := i.sign(copyClaims(mapClaims), TokenTypeRefresh, i.cfg.RefExpire)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	return TokenPair{
+		AccessToken:      accessToken,
+		ExpiresAt:        expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+	}, nil
+}
+
+// sign fills the standard claims missing in mapClaims and signs them.
+func (i *Issuer) sign(mapClaims map[string]interface{}, tokenType string, expire time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(expire)
+
+	defaults := map[string]interface{}{
+		ClaimIssuedAt:  now.Unix(),
+		ClaimNotBefore: now.Unix(),
+		ClaimExpiresAt: expiresAt.Unix(),
+		ClaimID:        utils.GenerateID(),
+	}
+	if i.cfg.Issuer != "" {
+		defaults[ClaimIssuer] = i.cfg.Issuer
+	}
+	if len(i.cfg.Audience) > 0 {
+		defaults[ClaimAudience] = Audience(i.cfg.Audience)
+	}
+	for claim, v := range defaults {
+		if _, ok := mapClaims[claim]; !ok {
+			mapClaims[claim] = v
+		}
+	}
+	if tokenType != "" {
+		mapClaims[ClaimTokenType] = tokenType
+	}
+
+	if exp, ok := mapClaims[ClaimExpiresAt].(float64); ok {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+
+	token, err := i.signer.SignToken(mapClaims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// familyExpiresAt bounds the expiry of the tokens of a family issued so far.
+func (i *Issuer) familyExpiresAt() time.Time {
+	return time.Now().Add(max(i.cfg.Expire, i.cfg.RefExpire) + i.clockSkew)
+}
+
+func toMapClaims(claims interface{}) (map[string]interface{}, error) {
+	byteClaim, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	mapClaims := make(map[string]interface{})
+	if err = json.Unmarshal(byteClaim, &mapClaims); err != nil {
+		return nil, err
+	}
+	return mapClaims, nil
+}
+
+func copyClaims(mapClaims map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(mapClaims))
+	for k, v := range mapClaims {
+		c[k] = v
+	}
+	return c
+}
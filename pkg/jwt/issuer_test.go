@@ -0,0 +1,153 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type testClaims struct {
+	StandardClaims
+	Roles []string `json:"roles"`
+}
+
+func newTestIssuer(t *testing.T, opts ...IssuerOption) *Issuer {
+	t.Helper()
+
+	cfg := JwtConfig{
+		Alg:        ES256,
+		PrivateKey: testPrivateKey(t, ES256),
+		Expire:     time.Minute,
+		RefExpire:  time.Hour,
+		Issuer:     "https://auth.example.com",
+		Audience:   []string{"orders"},
+	}
+	j, err := NewJWT(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewIssuer(j, cfg, opts...)
+}
+
+func TestIssuerStandardClaims(t *testing.T) {
+	issuer := newTestIssuer(t)
+
+	token, err := issuer.Issue(map[string]interface{}{"sub": "user", "roles": []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims testClaims
+	if err = issuer.Verifier().Verify(context.Background(), token, &claims); err != nil {
+		t.Fatalf("Verify() err = %v", err)
+	}
+	now := time.Now().Unix()
+	if claims.Issuer != "https://auth.example.com" || !claims.Audience.Contains("orders") || claims.Subject != "user" ||
+		claims.ID == "" || claims.IssuedAt > now || claims.NotBefore > now || claims.ExpiresAt != claims.IssuedAt+60 ||
+		len(claims.Roles) != 1 {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	tests := []struct {
+		name    string
+		opts    []VerifierOption
+		claims  map[string]interface{}
+		wantErr error
+	}{
+		{
+			name:    "other issuer",
+			opts:    []VerifierOption{WithIssuer("https://other.example.com")},
+			wantErr: ErrTokenInvalidIssuer,
+		},
+		{
+			name:    "other audience",
+			opts:    []VerifierOption{WithAudience("payments")},
+			wantErr: ErrTokenInvalidAudience,
+		},
+		{
+			name:    "expired",
+			claims:  map[string]interface{}{"exp": now - 10},
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name:   "expired within the clock skew",
+			opts:   []VerifierOption{WithClockSkew(time.Minute)},
+			claims: map[string]interface{}{"exp": now - 10},
+		},
+		{
+			name:    "not valid yet",
+			claims:  map[string]interface{}{"nbf": now + 30},
+			wantErr: ErrTokenNotValidYet,
+		},
+		{
+			// identity providers such as Keycloak set typ in their access tokens
+			name:   "typ claim of another issuer",
+			claims: map[string]interface{}{"typ": "Bearer"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := token
+			if tt.claims != nil {
+				if token, err = issuer.Issue(tt.claims); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var claims testClaims
+			err := NewVerifier(issuer.signer, tt.opts...).Verify(context.Background(), token, &claims)
+			if (tt.wantErr == nil && err != nil) || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIssuerRefresh(t *testing.T) {
+	ctx := context.Background()
+	issuer := newTestIssuer(t, WithIssuerTokenStore(NewMemoryTokenStore()))
+	verifier := issuer.Verifier()
+
+	pair, err := issuer.IssuePair(ctx, map[string]interface{}{"sub": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims testClaims
+	if err = verifier.Verify(ctx, pair.RefreshToken, &claims); !errors.Is(err, ErrTokenType) {
+		t.Fatalf("Verify(refresh token) err = %v, want ErrTokenType", err)
+	}
+
+	next, err := issuer.Refresh(ctx, pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = verifier.Verify(ctx, next.AccessToken, &claims); err != nil || claims.Subject != "user" {
+		t.Fatalf("Verify(refreshed) claims = %+v, err = %v", claims, err)
+	}
+
+	// the first refresh token is used again: the whole family is revoked
+	if _, err = issuer.Refresh(ctx, pair.RefreshToken); !errors.Is(err, ErrTokenReused) {
+		t.Fatalf("Refresh(reused) err = %v, want ErrTokenReused", err)
+	}
+	if _, err = issuer.Refresh(ctx, next.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Refresh(family revoked) err = %v, want ErrTokenRevoked", err)
+	}
+	if err = verifier.Verify(ctx, next.AccessToken, &claims); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Verify(family revoked) err = %v, want ErrTokenRevoked", err)
+	}
+
+	// logout
+	other, err := issuer.IssuePair(ctx, map[string]interface{}{"sub": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = issuer.Revoke(ctx, other.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = issuer.Refresh(ctx, other.RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Refresh(logged out) err = %v, want ErrTokenRevoked", err)
+	}
+}
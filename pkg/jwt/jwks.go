@@ -0,0 +1,192 @@
+package jwt
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+const defaultJWKSMaxAge = 5 * time.Minute
+
+var ErrInvalidJWK = errors.New("jwk invalid")
+
+// JWK is a public key as described by RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	// N and E are the modulus and the exponent of the RSA keys.
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv is the curve of the EC and OKP keys, X and Y their coordinates.
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+var curveNames = map[elliptic.Curve]string{
+	elliptic.P256(): "P-256",
+	elliptic.P384(): "P-384",
+	elliptic.P521(): "P-521",
+}
+
+// NewJWK builds the JWK of an RSA, ECDSA or Ed25519 public key.
+func NewJWK(kid, alg string, publicKey interface{}) (JWK, error) {
+	jwk := JWK{Kid: kid, Use: "sig", Alg: alg}
+
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+
+	case *ecdsa.PublicKey:
+		crv, ok := curveNames[pub.Curve]
+		if !ok {
+			return JWK{}, fmt.Errorf("%w: curve not supported", ErrInvalidJWK)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		jwk.Kty = "EC"
+		jwk.Crv = crv
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+		jwk.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+
+	default:
+		return JWK{}, fmt.Errorf("%w: key type %T not supported", ErrInvalidJWK, publicKey)
+	}
+
+	return jwk, nil
+}
+
+// PublicKey returns the *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey of the JWK.
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: rsa exponent", ErrInvalidJWK)
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		for c, name := range curveNames {
+			if name == k.Crv {
+				curve = c
+			}
+		}
+		if curve == nil {
+			return nil, fmt.Errorf("%w: curve %s", ErrInvalidJWK, k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("%w: point not on curve %s", ErrInvalidJWK, k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("%w: curve %s", ErrInvalidJWK, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: ed25519 key", ErrInvalidJWK)
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("%w: kty %s", ErrInvalidJWK, k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("%w: %q is not a base64url integer", ErrInvalidJWK, s)
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// Thumbprint returns the RFC 7638 thumbprint of a public key, used as its default kid.
+func Thumbprint(publicKey interface{}) (string, error) {
+	jwk, err := NewJWK("", "", publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	// the required members only, in lexicographic order
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+
+	sum := sha256.Sum256([]byte(members))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// Handler serves the JWKS of the key set, mounted on utils.PathJWKS:
+//
+//	e.GET(utils.PathJWKS, echo.WrapHandler(keySet.Handler(0)))
+//
+// maxAge is the time the verifiers may cache the keys; it defaults to 5 minutes. A key must
+// be published at least maxAge before it is activated.
+func (ks *KeySet) Handler(maxAge time.Duration) http.Handler {
+	if maxAge <= 0 {
+		maxAge = defaultJWKSMaxAge
+	}
+	cacheControl := "public, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		jwks, err := ks.JWKS()
+		if err != nil {
+			logger.GetLogger().Err(err).Msg("build jwks failed")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", cacheControl)
+		_ = json.NewEncoder(w).Encode(jwks)
+	})
+}
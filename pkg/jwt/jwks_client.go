@@ -0,0 +1,223 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+const (
+	defaultJWKSRefreshInterval    = 5 * time.Minute
+	defaultJWKSMinRefreshInterval = 30 * time.Second
+	defaultJWKSTimeout            = 10 * time.Second
+)
+
+// JWKSClientConfig locates the JWKS of the service issuing the tokens.
+type JWKSClientConfig struct {
+	URL string `env:"URL,required,notEmpty"`
+	// RefreshInterval is the period of the background refresh.
+	RefreshInterval time.Duration `env:"REFRESH_INTERVAL" envDefault:"5m"`
+	// MinRefreshInterval bounds the refreshes triggered by the tokens of an unknown kid, which
+	// are expected right after the issuer activates a new key.
+	MinRefreshInterval time.Duration `env:"MIN_REFRESH_INTERVAL" envDefault:"30s"`
+	Timeout            time.Duration `env:"TIMEOUT" envDefault:"10s"`
+}
+
+type jwksKey struct {
+	jwk       JWK
+	publicKey interface{}
+}
+
+// JWKSClient verifies the tokens of another service with the keys it publishes. The keys are
+// cached and refreshed in the background; they are kept when a refresh fails.
+type JWKSClient struct {
+	cfg        JWKSClientConfig
+	httpClient *http.Client
+
+	keys        []jwksKey
+	attemptedAt time.Time
+	mu          sync.RWMutex
+	// refreshMu lets one refresh run at a time
+	refreshMu sync.Mutex
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewJWKSClient starts the background refresh of the keys, stopped by Close. The first
+// fetch is started right away; a token verified before it ends waits for it.
+func NewJWKSClient(cfg JWKSClientConfig) *JWKSClient {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = defaultJWKSRefreshInterval
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = defaultJWKSMinRefreshInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultJWKSTimeout
+	}
+
+	c := &JWKSClient{
+		cfg:        cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		stop:       make(chan struct{}),
+	}
+	go c.run()
+
+	return c
+}
+
+func (c *JWKSClient) Close() {
+	c.stopOnce.Do(func() {
+		close(c.stop)
+	})
+}
+
+// VerifyAndParseToken verifies tokenStr with the published keys and parses its claims.
+func (c *JWKSClient) VerifyAndParseToken(ctx context.Context, tokenStr string, claims interface{}) error {
+	return VerifyWithKeys(ctx, c, tokenStr, claims)
+}
+
+// VerificationKeys returns the cached keys of kid and alg. An unknown kid refreshes the keys,
+// at most every MinRefreshInterval.
+func (c *JWKSClient) VerificationKeys(ctx context.Context, kid, alg string) ([]interface{}, error) {
+	if keys := c.lookup(kid, alg); len(keys) > 0 {
+		return keys, nil
+	}
+
+	if err := c.refresh(ctx, false); err != nil {
+		logger.GetLogger().Err(err).Str("url", c.cfg.URL).Msg("jwks refresh failed")
+	}
+	if keys := c.lookup(kid, alg); len(keys) > 0 {
+		return keys, nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+}
+
+func (c *JWKSClient) lookup(kid, alg string) []interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var keys []interface{}
+	for _, k := range c.keys {
+		if (kid == "" || k.jwk.Kid == kid) && jwkAllowsAlg(k.jwk, alg) {
+			keys = append(keys, k.publicKey)
+		}
+	}
+	return keys
+}
+
+func (c *JWKSClient) run() {
+	if err := c.refresh(context.Background(), true); err != nil {
+		logger.GetLogger().Err(err).Str("url", c.cfg.URL).Msg("jwks fetch failed")
+	}
+
+	ticker := time.NewTicker(c.cfg.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			if err := c.refresh(context.Background(), true); err != nil {
+				logger.GetLogger().Err(err).Str("url", c.cfg.URL).Msg("jwks refresh failed, keeping the cached keys")
+			}
+		}
+	}
+}
+
+// refresh fetches the keys. Unless force is set, it does nothing when another refresh started
+// within MinRefreshInterval; it then returns once that refresh ended.
+func (c *JWKSClient) refresh(ctx context.Context, force bool) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.Lock()
+	if !force && time.Since(c.attemptedAt) < c.cfg.MinRefreshInterval {
+		c.mu.Unlock()
+		return nil
+	}
+	c.attemptedAt = time.Now()
+	c.mu.Unlock()
+
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+
+	return nil
+}
+
+func (c *JWKSClient) fetch(ctx context.Context) ([]jwksKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.cfg.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks status code: %d", res.StatusCode)
+	}
+
+	var jwks JWKS
+	if err = json.NewDecoder(io.LimitReader(res.Body, 1<<20)).Decode(&jwks); err != nil {
+		return nil, fmt.Errorf("decode jwks: %w", err)
+	}
+
+	var keys []jwksKey
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		publicKey, err := jwk.PublicKey()
+		if err != nil {
+			// the other keys stay usable
+			logger.GetLogger().Warn().Err(err).Str("kid", jwk.Kid).Msg("jwks key skipped")
+			continue
+		}
+		keys = append(keys, jwksKey{jwk: jwk, publicKey: publicKey})
+	}
+
+	return keys, nil
+}
+
+// jwkAllowsAlg reports whether alg may be verified with jwk, from its alg or, when it has
+// none, its key type.
+func jwkAllowsAlg(jwk JWK, alg string) bool {
+	if jwk.Alg != "" {
+		return jwk.Alg == alg
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case "EC":
+		return (alg == ES256 && jwk.Crv == "P-256") ||
+			(alg == ES384 && jwk.Crv == "P-384") ||
+			(alg == ES512 && jwk.Crv == "P-521")
+	case "OKP":
+		return alg == EdDSA
+	default:
+		return false
+	}
+}
@@ -1,6 +1,7 @@
 package jwt
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"crypto/ed25519"
 	"crypto/rsa"
@@ -26,8 +27,12 @@ const (
 	EdDSA = "EdDSA"
 )
 
+// HeaderKid is the header naming the key that signed a token.
+const HeaderKid = "kid"
+
 type JWT struct {
 	alg        string
+	kid        string
 	privateKey interface{}
 	publicKey  interface{}
 	expire     time.Duration
@@ -35,72 +40,96 @@ type JWT struct {
 }
 
 func NewJWT(cfg JwtConfig) (*JWT, error) {
-	_jwt := &JWT{
-		alg:       cfg.Alg,
-		expire:    cfg.Expire,
-		refExpire: cfg.RefExpire,
+	privateKey, publicKey, err := parsePrivateKey(cfg.Alg, cfg.PrivateKey)
+	if err != nil {
+		return nil, err
 	}
 
-	switch cfg.Alg {
+	return &JWT{
+		alg:        cfg.Alg,
+		kid:        cfg.Kid,
+		privateKey: privateKey,
+		publicKey:  publicKey,
+		expire:     cfg.Expire,
+		refExpire:  cfg.RefExpire,
+	}, nil
+}
+
+// parsePrivateKey parses the PEM private key of alg and builds its public key.
+func parsePrivateKey(alg, privateKey string) (interface{}, interface{}, error) {
+	switch alg {
 	case RS256, RS384, RS512, PS256, PS384, PS512:
 		// parse private key
-		pk, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+		pk, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(privateKey))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		_jwt.privateKey = pk
-
 		// build public key from private key
 		pubKey, err := utils.GetRSAPublicKeyFromPrivateKey(pk)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		_jwt.publicKey = pubKey
-		break
+		return pk, pubKey, nil
 
 	case ES256, ES384, ES512:
 		// parse private key
-		pk, err := jwt.ParseECPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+		pk, err := jwt.ParseECPrivateKeyFromPEM([]byte(privateKey))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
-		_jwt.privateKey = pk
-		_jwt.publicKey = &pk.PublicKey
-		break
+		return pk, &pk.PublicKey, nil
 
 	case EdDSA:
 		// parse private key
-		pk, err := jwt.ParseEdPrivateKeyFromPEM([]byte(cfg.PrivateKey))
+		pk, err := jwt.ParseEdPrivateKeyFromPEM([]byte(privateKey))
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 
 		// get public key from private key
 		pkEd25519, ok := pk.(ed25519.PrivateKey)
 		if !ok {
-			return nil, fmt.Errorf("key is not a valid Ed25519 private key")
+			return nil, nil, fmt.Errorf("key is not a valid Ed25519 private key")
 		}
 
 		pubEd25519, ok := pkEd25519.Public().(ed25519.PublicKey)
 		if !ok {
-			return nil, fmt.Errorf("key is not a valid Ed25519 public key")
+			return nil, nil, fmt.Errorf("key is not a valid Ed25519 public key")
 		}
 
-		_jwt.privateKey = pk
-		_jwt.publicKey = pubEd25519
-		break
+		return pk, pubEd25519, nil
 
 	default:
-		return nil, fmt.Errorf("alg invalid: %s", cfg.Alg)
+		return nil, nil, fmt.Errorf("alg invalid: %s", alg)
 	}
+}
+
+// parsePublicKey parses the PEM public key of alg.
+func parsePublicKey(alg, publicKey string) (interface{}, error) {
+	switch alg {
+	case RS256, RS384, RS512, PS256, PS384, PS512:
+		return jwt.ParseRSAPublicKeyFromPEM([]byte(publicKey))
+
+	case ES256, ES384, ES512:
+		return jwt.ParseECPublicKeyFromPEM([]byte(publicKey))
 
-	return _jwt, nil
+	case EdDSA:
+		return jwt.ParseEdPublicKeyFromPEM([]byte(publicKey))
+
+	default:
+		return nil, fmt.Errorf("alg invalid: %s", alg)
+	}
 }
 
+// SignToken signs claims, with the kid of the config in the header when it is set.
 func (j *JWT) SignToken(claims interface{}) (string, error) {
+	return signClaims(j.alg, j.kid, j.privateKey, claims)
+}
+
+func signClaims(alg, kid string, privateKey, claims interface{}) (string, error) {
 	byteClaim, err := json.Marshal(claims)
 	if err != nil {
 		return "", err
@@ -112,9 +141,12 @@ func (j *JWT) SignToken(claims interface{}) (string, error) {
 		return "", err
 	}
 
-	token := jwt.NewWithClaims(jwt.GetSigningMethod(j.alg), mapClaims)
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(alg), mapClaims)
+	if kid != "" {
+		token.Header[HeaderKid] = kid
+	}
 
-	return token.SignedString(j.privateKey)
+	return token.SignedString(privateKey)
 }
 
 func (j *JWT) VerifyAndParseToken(tokenStr string, claims interface{}) error {
@@ -152,6 +184,14 @@ func (j *JWT) VerifyAndParseToken(tokenStr string, claims interface{}) error {
 	return nil
 }
 
+// VerificationKeys returns the public key of j, for a Verifier.
+func (j *JWT) VerificationKeys(ctx context.Context, kid, alg string) ([]interface{}, error) {
+	if alg != j.alg || (kid != "" && j.kid != "" && kid != j.kid) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	return []interface{}{j.publicKey}, nil
+}
+
 func (j *JWT) GetExpire() time.Duration {
 	return j.expire
 }
@@ -0,0 +1,255 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type KeyStatus string
+
+const (
+	// KeyStatusActive signs the new tokens, and verifies them. A key set has one active key.
+	KeyStatusActive KeyStatus = "active"
+	// KeyStatusVerify only verifies: a key published before it is activated, or the previous
+	// active key until the tokens it signed expire.
+	KeyStatusVerify KeyStatus = "verify"
+	// KeyStatusRetired is neither published nor trusted anymore.
+	KeyStatusRetired KeyStatus = "retired"
+)
+
+var (
+	ErrUnknownKey   = errors.New("jwt key unknown or retired")
+	ErrNoActiveKey  = errors.New("jwt key set has no active key")
+	ErrDuplicateKey = errors.New("jwt key already in the key set")
+	ErrKeyStatus    = errors.New("jwt key status invalid")
+)
+
+// KeyConfig is a key of a KeySet.
+type KeyConfig struct {
+	// ID is the kid of the key. It defaults to the RFC 7638 thumbprint of the public key.
+	ID  string `env:"ID"`
+	Alg string `env:"ALG,required,notEmpty"` // support: RS256, RS384, RS512, ES256, ES384, ES512, PS256, PS384, PS512, EdDSA
+	// PrivateKey is a PEM private key; a key without it can only verify.
+	PrivateKey string `env:"PRIVATE_KEY"`
+	// PublicKey is a PEM public key, read when PrivateKey is empty.
+	PublicKey string    `env:"PUBLIC_KEY"`
+	Status    KeyStatus `env:"STATUS" envDefault:"verify"`
+}
+
+// KeyProvider returns the keys that may have signed a token, from the kid and the alg of its
+// header. The kid is empty for the tokens signed without one.
+type KeyProvider interface {
+	VerificationKeys(ctx context.Context, kid, alg string) ([]interface{}, error)
+}
+
+type key struct {
+	id         string
+	alg        string
+	status     KeyStatus
+	privateKey interface{}
+	publicKey  interface{}
+}
+
+// KeySet signs the tokens with its active key, setting the kid header, and verifies them
+// with any key not retired, so that the signing key is rotated without breaking the tokens
+// already issued:
+//
+//  1. add the new key with KeyStatusVerify, and wait for the verifiers to refresh the JWKS
+//  2. Activate it; the previous active key only verifies from now on
+//  3. Retire the previous key once the tokens it signed have expired
+type KeySet struct {
+	keys   []*key
+	active *key
+	mu     sync.RWMutex
+}
+
+func NewKeySet(keys ...KeyConfig) (*KeySet, error) {
+	ks := &KeySet{}
+	for _, cfg := range keys {
+		if err := ks.AddKey(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	return ks, nil
+}
+
+// AddKey adds a key. An active key replaces the active one, which then only verifies.
+func (ks *KeySet) AddKey(cfg KeyConfig) error {
+	k := &key{alg: cfg.Alg, status: cfg.Status}
+	if k.status == "" {
+		k.status = KeyStatusVerify
+	}
+
+	var err error
+	switch {
+	case cfg.PrivateKey != "":
+		k.privateKey, k.publicKey, err = parsePrivateKey(cfg.Alg, cfg.PrivateKey)
+	case cfg.PublicKey != "":
+		k.publicKey, err = parsePublicKey(cfg.Alg, cfg.PublicKey)
+	default:
+		err = errors.New("private key or public key required")
+	}
+	if err != nil {
+		return fmt.Errorf("jwt key %s: %w", cfg.ID, err)
+	}
+
+	k.id = cfg.ID
+	if k.id == "" {
+		if k.id, err = Thumbprint(k.publicKey); err != nil {
+			return err
+		}
+	}
+
+	switch k.status {
+	case KeyStatusActive:
+		if k.privateKey == nil {
+			return fmt.Errorf("%w: key %s has no private key to be active", ErrKeyStatus, k.id)
+		}
+	case KeyStatusVerify, KeyStatusRetired:
+	default:
+		return fmt.Errorf("%w: %s", ErrKeyStatus, k.status)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if ks.find(k.id) != nil {
+		return fmt.Errorf("%w: %s", ErrDuplicateKey, k.id)
+	}
+	ks.keys = append(ks.keys, k)
+	if k.status == KeyStatusActive {
+		ks.activate(k)
+	}
+
+	return nil
+}
+
+// Activate makes the key kid sign the new tokens.
+func (ks *KeySet) Activate(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	k := ks.find(kid)
+	if k == nil || k.status == KeyStatusRetired {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	if k.privateKey == nil {
+		return fmt.Errorf("%w: key %s has no private key to be active", ErrKeyStatus, kid)
+	}
+
+	ks.activate(k)
+	return nil
+}
+
+// Retire stops trusting the key kid. The active key can not be retired, another key must be
+// activated first.
+func (ks *KeySet) Retire(kid string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	k := ks.find(kid)
+	if k == nil {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+	if k == ks.active {
+		return fmt.Errorf("%w: key %s is active", ErrKeyStatus, kid)
+	}
+
+	k.status = KeyStatusRetired
+	return nil
+}
+
+// ActiveKeyID returns the kid of the active key, empty when there is none.
+func (ks *KeySet) ActiveKeyID() string {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	if ks.active == nil {
+		return ""
+	}
+	return ks.active.id
+}
+
+// SignToken signs claims with the active key.
+func (ks *KeySet) SignToken(claims interface{}) (string, error) {
+	ks.mu.RLock()
+	active := ks.active
+	ks.mu.RUnlock()
+
+	if active == nil {
+		return "", ErrNoActiveKey
+	}
+
+	return signClaims(active.alg, active.id, active.privateKey, claims)
+}
+
+// VerifyAndParseToken verifies tokenStr with the key of its kid, or with every key of its alg
+// when it has no kid, and parses its claims.
+func (ks *KeySet) VerifyAndParseToken(tokenStr string, claims interface{}) error {
+	return VerifyWithKeys(context.Background(), ks, tokenStr, claims)
+}
+
+func (ks *KeySet) VerificationKeys(ctx context.Context, kid, alg string) ([]interface{}, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var keys []interface{}
+	for _, k := range ks.keys {
+		if k.status == KeyStatusRetired || k.alg != alg || (kid != "" && k.id != kid) {
+			continue
+		}
+		keys = append(keys, k.publicKey)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	return keys, nil
+}
+
+// JWKS returns the public keys not retired, the active one first.
+func (ks *KeySet) JWKS() (JWKS, error) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if k.status == KeyStatusRetired {
+			continue
+		}
+
+		jwk, err := NewJWK(k.id, k.alg, k.publicKey)
+		if err != nil {
+			return JWKS{}, err
+		}
+		if k == ks.active {
+			jwks.Keys = append([]JWK{jwk}, jwks.Keys...)
+		} else {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+
+	return jwks, nil
+}
+
+// find is called with the lock held.
+func (ks *KeySet) find(kid string) *key {
+	for _, k := range ks.keys {
+		if k.id == kid {
+			return k
+		}
+	}
+	return nil
+}
+
+// activate is called with the lock held.
+func (ks *KeySet) activate(k *key) {
+	if ks.active != nil && ks.active != k {
+		ks.active.status = KeyStatusVerify
+	}
+	k.status = KeyStatusActive
+	ks.active = k
+}
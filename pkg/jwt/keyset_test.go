@@ -0,0 +1,174 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	logger "go-source/pkg/log"
+)
+
+func testPrivateKey(t *testing.T, alg string) string {
+	t.Helper()
+
+	var key interface{}
+	var err error
+	switch alg {
+	case RS256:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestKeySetRotation(t *testing.T) {
+	ks, err := NewKeySet(KeyConfig{ID: "k1", Alg: ES256, PrivateKey: testPrivateKey(t, ES256), Status: KeyStatusActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"sub": "user"}
+	oldToken, err := ks.SignToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ks.AddKey(KeyConfig{ID: "k2", Alg: RS256, PrivateKey: testPrivateKey(t, RS256)}); err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.Activate("k2"); err != nil {
+		t.Fatal(err)
+	}
+
+	newToken, err := ks.SignToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var header map[string]interface{}
+	if err = ParseHeader(newToken, &header); err != nil || header[HeaderKid] != "k2" {
+		t.Fatalf("header = %v, err = %v, want kid k2", header, err)
+	}
+
+	var got map[string]interface{}
+	for _, token := range []string{oldToken, newToken} {
+		if err = ks.VerifyAndParseToken(token, &got); err != nil || got["sub"] != "user" {
+			t.Fatalf("VerifyAndParseToken() claims = %v, err = %v", got, err)
+		}
+	}
+
+	if err = ks.Retire("k2"); !errors.Is(err, ErrKeyStatus) {
+		t.Fatalf("Retire(active) err = %v, want ErrKeyStatus", err)
+	}
+	if err = ks.Retire("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = ks.VerifyAndParseToken(oldToken, &got); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("VerifyAndParseToken(retired) err = %v, want ErrUnknownKey", err)
+	}
+
+	jwks, err := ks.JWKS()
+	if err != nil || len(jwks.Keys) != 1 || jwks.Keys[0].Kid != "k2" {
+		t.Fatalf("JWKS() = %+v, err = %v, want k2 only", jwks, err)
+	}
+}
+
+func TestKeySetVerifiesTokensWithoutKid(t *testing.T) {
+	privateKey := testPrivateKey(t, EdDSA)
+
+	j, err := NewJWT(JwtConfig{Alg: EdDSA, PrivateKey: privateKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := j.SignToken(map[string]interface{}{"sub": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ks, err := NewKeySet(KeyConfig{Alg: EdDSA, PrivateKey: privateKey, Status: KeyStatusActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err = ks.VerifyAndParseToken(token, &claims); err != nil {
+		t.Fatalf("VerifyAndParseToken() err = %v", err)
+	}
+}
+
+func TestJWKSClient(t *testing.T) {
+	logger.InitLog("jwt-test")
+	ks, err := NewKeySet(KeyConfig{ID: "rsa", Alg: RS256, PrivateKey: testPrivateKey(t, RS256), Status: KeyStatusActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(ks.Handler(time.Minute))
+	defer server.Close()
+
+	res, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var jwks JWKS
+	_ = json.NewDecoder(res.Body).Decode(&jwks)
+	_ = res.Body.Close()
+	if res.Header.Get("Cache-Control") != "public, max-age=60" || len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "RSA" {
+		t.Fatalf("jwks = %+v, cache control = %q", jwks, res.Header.Get("Cache-Control"))
+	}
+
+	c := NewJWKSClient(JWKSClientConfig{URL: server.URL, MinRefreshInterval: time.Millisecond})
+	defer c.Close()
+
+	// every key type, published before it is activated or found by the refresh of its kid
+	for _, alg := range []string{ES256, EdDSA, RS256} {
+		kid := "key-" + alg
+		if err = ks.AddKey(KeyConfig{ID: kid, Alg: alg, PrivateKey: testPrivateKey(t, alg), Status: KeyStatusActive}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+
+		token, err := ks.SignToken(map[string]interface{}{"sub": kid})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var claims map[string]interface{}
+		if err = c.VerifyAndParseToken(context.Background(), token, &claims); err != nil || claims["sub"] != kid {
+			t.Fatalf("%s: VerifyAndParseToken() claims = %v, err = %v", alg, claims, err)
+		}
+	}
+
+	// a token of a key not published is rejected
+	other, err := NewKeySet(KeyConfig{ID: "other", Alg: ES256, PrivateKey: testPrivateKey(t, ES256), Status: KeyStatusActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := other.SignToken(map[string]interface{}{"sub": "other"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims map[string]interface{}
+	if err = c.VerifyAndParseToken(context.Background(), token, &claims); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("VerifyAndParseToken(unpublished) err = %v, want ErrUnknownKey", err)
+	}
+}
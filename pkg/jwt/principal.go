@@ -0,0 +1,95 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+)
+
+// keyPrincipal holds the principal of a request verified by the middlewares
+const keyPrincipal = "jwt_principal"
+
+// Principal is the caller of a request, from the claims of its verified access token.
+type Principal struct {
+	StandardClaims
+	// Type is the IAS type of the caller: utils.IASTypeService, IASTypeClient, IASTypePublic
+	// or IASTypeInternal.
+	Type   string   `json:"type,omitempty"`
+	Roles  []string `json:"roles,omitempty"`
+	Scopes Scopes   `json:"scope,omitempty"`
+
+	// Token is the access token, to be forwarded to other services.
+	Token string `json:"-"`
+	// Claims holds every claim of the token, for the ones not mapped above.
+	Claims map[string]interface{} `json:"-"`
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Scopes is the scope claim, a space separated string (RFC 8693) or an array of strings.
+type Scopes []string
+
+func (s Scopes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strings.Join(s, " "))
+}
+
+func (s *Scopes) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*s = nil
+		return nil
+	}
+
+	var scope string
+	if err := json.Unmarshal(data, &scope); err == nil {
+		*s = strings.Fields(scope)
+		return nil
+	}
+
+	var scopes []string
+	if err := json.Unmarshal(data, &scopes); err != nil {
+		return err
+	}
+	*s = scopes
+	return nil
+}
+
+// VerifyPrincipal verifies the access token tokenStr and returns its principal.
+func (v *Verifier) VerifyPrincipal(ctx context.Context, tokenStr string) (*Principal, error) {
+	mapClaims, _, err := v.verify(ctx, tokenStr, "")
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{Token: tokenStr, Claims: mapClaims}
+	if err = decodeClaims(mapClaims, principal); err != nil {
+		return nil, err
+	}
+
+	return principal, nil
+}
+
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, keyPrincipal, principal)
+}
+
+// PrincipalFromContext returns the principal set by the authentication middlewares.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(keyPrincipal).(*Principal)
+	return principal, ok && principal != nil
+}
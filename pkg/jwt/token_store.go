@@ -0,0 +1,144 @@
+package jwt
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go-source/pkg/database/redis"
+)
+
+const (
+	KeyJwtRevoked = "jwt_revoked:"
+	KeyJwtUsed    = "jwt_used:"
+)
+
+// TokenStore records the revoked tokens and the used refresh tokens. The records expire with
+// the tokens.
+type TokenStore interface {
+	// Revoke rejects the tokens whose jti, or fid, is id until exp.
+	Revoke(ctx context.Context, id string, exp time.Time) error
+	// IsRevoked reports whether one of ids is revoked. Empty ids are skipped.
+	IsRevoked(ctx context.Context, ids ...string) (bool, error)
+	// Use records the use of the refresh token jti until exp, and reports whether it is its
+	// first use.
+	Use(ctx context.Context, jti string, exp time.Time) (bool, error)
+}
+
+// MemoryTokenStore keeps the records in process. Tokens revoked by an instance are only
+// rejected by this instance; a shared store is needed across instances.
+type MemoryTokenStore struct {
+	revoked   map[string]time.Time
+	used      map[string]time.Time
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		revoked:   make(map[string]time.Time),
+		used:      make(map[string]time.Time),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *MemoryTokenStore) Revoke(ctx context.Context, id string, exp time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	s.revoked[id] = exp
+	return nil
+}
+
+func (s *MemoryTokenStore) IsRevoked(ctx context.Context, ids ...string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, id := range ids {
+		if exp, ok := s.revoked[id]; ok && id != "" && now.Before(exp) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryTokenStore) Use(ctx context.Context, jti string, exp time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep()
+	if usedExp, ok := s.used[jti]; ok && time.Now().Before(usedExp) {
+		return false, nil
+	}
+	s.used[jti] = exp
+	return true, nil
+}
+
+// sweep drops the expired records, at most every minute. It is called with the lock held.
+func (s *MemoryTokenStore) sweep() {
+	now := time.Now()
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+
+	for _, records := range []map[string]time.Time{s.revoked, s.used} {
+		for id, exp := range records {
+			if now.After(exp) {
+				delete(records, id)
+			}
+		}
+	}
+	s.lastSweep = now
+}
+
+// RedisTokenStore keeps the records in Redis, shared by the instances of the services.
+type RedisTokenStore struct {
+	client *redis.Client
+}
+
+func NewRedisTokenStore(client *redis.Client) *RedisTokenStore {
+	return &RedisTokenStore{client: client}
+}
+
+func (s *RedisTokenStore) Revoke(ctx context.Context, id string, exp time.Time) error {
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return nil
+	}
+	return s.client.SetString(ctx, KeyJwtRevoked+id, "1", ttl)
+}
+
+func (s *RedisTokenStore) IsRevoked(ctx context.Context, ids ...string) (bool, error) {
+	client := s.client.GetClient()
+	if client == nil {
+		return false, errors.New("redis client is nil")
+	}
+
+	var keys []string
+	for _, id := range ids {
+		if id != "" {
+			keys = append(keys, KeyJwtRevoked+id)
+		}
+	}
+	if len(keys) == 0 {
+		return false, nil
+	}
+
+	n, err := client.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Use claims the jti with SETNX, so that concurrent uses of a refresh token are detected.
+func (s *RedisTokenStore) Use(ctx context.Context, jti string, exp time.Time) (bool, error) {
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		ttl = time.Second
+	}
+	return s.client.AcquireLock(ctx, KeyJwtUsed+jti, ttl)
+}
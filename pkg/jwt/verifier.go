@@ -0,0 +1,184 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrTokenExpired         = jwt.ErrTokenExpired
+	ErrTokenNotValidYet     = jwt.ErrTokenNotValidYet
+	ErrTokenInvalidIssuer   = jwt.ErrTokenInvalidIssuer
+	ErrTokenInvalidAudience = jwt.ErrTokenInvalidAudience
+	ErrTokenRevoked         = errors.New("jwt token revoked")
+	ErrTokenType            = errors.New("jwt token type invalid")
+	// ErrTokenStoreUnavailable is returned, wrapped, when the token store could not tell
+	// whether a token is revoked. The token may be valid: the caller should retry later.
+	ErrTokenStoreUnavailable = errors.New("jwt token store unavailable")
+)
+
+type verifierOptions struct {
+	issuer    string
+	audience  string
+	clockSkew time.Duration
+	store     TokenStore
+}
+
+type VerifierOption func(o *verifierOptions)
+
+// WithIssuer requires the iss claim to be issuer.
+func WithIssuer(issuer string) VerifierOption {
+	return func(o *verifierOptions) {
+		o.issuer = issuer
+	}
+}
+
+// WithAudience requires audience to be one of the aud claim.
+func WithAudience(audience string) VerifierOption {
+	return func(o *verifierOptions) {
+		o.audience = audience
+	}
+}
+
+// WithClockSkew tolerates the clocks of the issuer and the verifier to differ by skew when
+// checking exp, nbf and iat.
+func WithClockSkew(skew time.Duration) VerifierOption {
+	return func(o *verifierOptions) {
+		o.clockSkew = skew
+	}
+}
+
+// WithTokenStore rejects the tokens revoked in store, or whose family is.
+func WithTokenStore(store TokenStore) VerifierOption {
+	return func(o *verifierOptions) {
+		o.store = store
+	}
+}
+
+// Verifier verifies the signature and the standard claims of the access tokens: exp is
+// required, nbf and iat must be past, iss and aud are checked when set by the options.
+type Verifier struct {
+	keys KeyProvider
+	opts verifierOptions
+}
+
+// NewVerifier verifies the tokens with the keys of a JWT, a KeySet or a JWKSClient.
+func NewVerifier(keys KeyProvider, opts ...VerifierOption) *Verifier {
+	v := &Verifier{keys: keys}
+	for _, opt := range opts {
+		opt(&v.opts)
+	}
+
+	return v
+}
+
+// Verify verifies the access token tokenStr and parses its claims.
+func (v *Verifier) Verify(ctx context.Context, tokenStr string, claims interface{}) error {
+	mapClaims, _, err := v.verify(ctx, tokenStr, "")
+	if err != nil {
+		return err
+	}
+
+	return decodeClaims(mapClaims, claims)
+}
+
+// verify verifies a token of tokenType, empty for the access tokens.
+func (v *Verifier) verify(ctx context.Context, tokenStr, tokenType string) (jwt.MapClaims, StandardClaims, error) {
+	parserOpts := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(v.opts.clockSkew),
+	}
+	if v.opts.issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(v.opts.issuer))
+	}
+	if v.opts.audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(v.opts.audience))
+	}
+
+	mapClaims, err := parseWithKeys(ctx, v.keys, tokenStr, parserOpts...)
+	if err != nil {
+		return nil, StandardClaims{}, err
+	}
+
+	var std StandardClaims
+	if err = decodeClaims(mapClaims, &std); err != nil {
+		return nil, StandardClaims{}, err
+	}
+
+	// other issuers may set typ in their access tokens, so only refresh tokens are rejected
+	if (tokenType == "" && std.TokenType == TokenTypeRefresh) || (tokenType != "" && std.TokenType != tokenType) {
+		return nil, StandardClaims{}, fmt.Errorf("%w: %q", ErrTokenType, std.TokenType)
+	}
+
+	if v.opts.store != nil {
+		revoked, err := v.opts.store.IsRevoked(ctx, std.ID, std.FamilyID)
+		if err != nil {
+			return nil, StandardClaims{}, fmt.Errorf("%w: %w", ErrTokenStoreUnavailable, err)
+		}
+		if revoked {
+			return nil, StandardClaims{}, ErrTokenRevoked
+		}
+	}
+
+	return mapClaims, std, nil
+}
+
+// VerifyWithKeys verifies the signature of tokenStr with the keys of provider and parses its
+// claims. Unlike a Verifier, it only checks exp, nbf and iat when they are set.
+func VerifyWithKeys(ctx context.Context, provider KeyProvider, tokenStr string, claims interface{}) error {
+	mapClaims, err := parseWithKeys(ctx, provider, tokenStr)
+	if err != nil {
+		return err
+	}
+
+	return decodeClaims(mapClaims, claims)
+}
+
+func parseWithKeys(ctx context.Context, provider KeyProvider, tokenStr string, opts ...jwt.ParserOption) (jwt.MapClaims, error) {
+	// Parse jwt and check sign
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header[HeaderKid].(string)
+
+		keys, err := provider.VerificationKeys(ctx, kid, token.Method.Alg())
+		if err != nil {
+			return nil, err
+		}
+
+		keySet := jwt.VerificationKeySet{}
+		for _, k := range keys {
+			keySet.Keys = append(keySet.Keys, k)
+		}
+		return keySet, nil
+	}, opts...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// check token valid
+	if !token.Valid {
+		return nil, fmt.Errorf("token invalid")
+	}
+
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("token invalid")
+	}
+
+	return mapClaims, nil
+}
+
+func decodeClaims(mapClaims jwt.MapClaims, claims interface{}) error {
+	byteClaim, err := json.Marshal(mapClaims)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(byteClaim, claims)
+}
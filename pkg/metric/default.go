@@ -12,4 +12,44 @@ var (
 	HttpClientMetricHistogram = NewGlobalHistogramInstrument(
 		"http_client", "Time to call http client",
 	)
+
+	KafkaConsumerLagGauge = NewGlobalGaugeInstrument(
+		"kafka_consumer_lag", "Messages between the high watermark and the consumed offset of a partition",
+	)
+
+	KafkaProducerDeliveryCounter = NewGlobalCounterInstrument(
+		"kafka_producer_delivery", "Delivery reports of produced messages by result",
+	)
+
+	KafkaConsumerInFlightUpDownCounter = NewGlobalUpDownCounterInstrument(
+		"kafka_consumer_in_flight", "Messages dispatched to consumer workers and not yet handled",
+	)
+
+	MsgHandlerMetricHistogram = NewGlobalHistogramInstrument(
+		"msg_handler", "Time to handle a consumed event",
+	)
+
+	MsgDuplicateCounter = NewGlobalCounterInstrument(
+		"msg_duplicate", "Consumed events skipped as already handled",
+	)
+
+	EventBusQueueDepthUpDownCounter = NewGlobalUpDownCounterInstrument(
+		"event_bus_queue_depth", "Events waiting in event bus subscriber buffers",
+	)
+
+	EventBusHandlerMetricHistogram = NewGlobalHistogramInstrument(
+		"event_bus_handler", "Time to handle an event bus event",
+	)
+
+	CircuitBreakerStateGauge = NewGlobalGaugeInstrument(
+		"circuit_breaker_state", "State of a circuit breaker: 0 closed, 1 open, 2 half-open",
+	)
+
+	HttpClientRejectedCounter = NewGlobalCounterInstrument(
+		"http_client_rejected", "Http client requests rejected by a circuit breaker or a bulkhead",
+	)
+
+	EventBusErrorCounter = NewGlobalCounterInstrument(
+		"event_bus_error", "Event bus events that failed, panicked or could not be delivered",
+	)
 )
@@ -7,13 +7,19 @@ import (
 const (
 	InstrumentationName = "base_metric"
 
-	HttpComponent = "http"
+	HttpComponent     = "http"
+	KafkaComponent    = "kafka"
+	MsgComponent      = "msg"
+	EventBusComponent = "event_bus"
 )
 
 const (
 	ComponentAttr = "component"
 	MethodAttr    = "method"
 	CodeAttr      = "code"
+	TopicAttr     = "topic"
+	PartitionAttr = "partition"
+	BreakerAttr   = "breaker"
 )
 
 var (
@@ -2,6 +2,7 @@ package metric
 
 import (
 	"context"
+	"strconv"
 	"time"
 
 	meter "go.opentelemetry.io/otel/metric"
@@ -154,3 +155,68 @@ func NewHttpClientHistogramDuration(component, method, code string, duration tim
 		WithHistogram(HttpClientMetricHistogram),
 	).SetMillisDuration(duration).Record()
 }
+
+func RecordKafkaConsumerLag(topic string, partition int32, lag int64) {
+	label := NewLabel(
+		WithComponent(KafkaComponent),
+		WithAttributes(NewBiTags(TopicAttr, topic, PartitionAttr, strconv.Itoa(int(partition)))),
+	)
+	KafkaConsumerLagGauge.Record(context.Background(), lag, meter.WithAttributes(label.GetAttributes()...))
+}
+
+func AddKafkaConsumerInFlight(topic string, delta int64) {
+	label := NewLabel(WithComponent(KafkaComponent), WithAttributes(NewTags(TopicAttr, topic)))
+	KafkaConsumerInFlightUpDownCounter.Add(context.Background(), delta, meter.WithAttributes(label.GetAttributes()...))
+}
+
+func RecordKafkaProducerDelivery(topic, code string) {
+	label := NewLabel(WithComponent(KafkaComponent), WithCode(code), WithAttributes(NewTags(TopicAttr, topic)))
+	KafkaProducerDeliveryCounter.Add(context.Background(), 1, meter.WithAttributes(label.GetAttributes()...))
+}
+
+func NewMsgHandlerHistogramDuration(eventType, code string, duration time.Duration) {
+	_ = NewMetric(
+		WithLabel(
+			WithComponent(MsgComponent),
+			WithMethod(eventType),
+			WithCode(code),
+		),
+		WithHistogram(MsgHandlerMetricHistogram),
+	).SetMillisDuration(duration).Record()
+}
+
+func RecordMsgDuplicate(eventType string) {
+	label := NewLabel(WithComponent(MsgComponent), WithMethod(eventType))
+	MsgDuplicateCounter.Add(context.Background(), 1, meter.WithAttributes(label.GetAttributes()...))
+}
+
+func AddEventBusQueueDepth(eventType string, delta int64) {
+	label := NewLabel(WithComponent(EventBusComponent), WithMethod(eventType))
+	EventBusQueueDepthUpDownCounter.Add(context.Background(), delta, meter.WithAttributes(label.GetAttributes()...))
+}
+
+func NewEventBusHandlerHistogramDuration(eventType, code string, duration time.Duration) {
+	_ = NewMetric(
+		WithLabel(
+			WithComponent(EventBusComponent),
+			WithMethod(eventType),
+			WithCode(code),
+		),
+		WithHistogram(EventBusHandlerMetricHistogram),
+	).SetMillisDuration(duration).Record()
+}
+
+func RecordEventBusError(eventType, code string) {
+	label := NewLabel(WithComponent(EventBusComponent), WithMethod(eventType), WithCode(code))
+	EventBusErrorCounter.Add(context.Background(), 1, meter.WithAttributes(label.GetAttributes()...))
+}
+
+func RecordCircuitBreakerState(component, name string, state int64) {
+	label := NewLabel(WithComponent(component), WithAttributes(NewTags(BreakerAttr, name)))
+	CircuitBreakerStateGauge.Record(context.Background(), state, meter.WithAttributes(label.GetAttributes()...))
+}
+
+func RecordHttpClientRejected(name, code string) {
+	label := NewLabel(WithComponent(HttpComponent), WithCode(code), WithAttributes(NewTags(BreakerAttr, name)))
+	HttpClientRejectedCounter.Add(context.Background(), 1, meter.WithAttributes(label.GetAttributes()...))
+}
@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"go-source/pkg/client"
+	"go-source/pkg/jwt"
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+)
+
+// Authentication verifies the access token of every request locally with verifier, and sets
+// its jwt.Principal, and its sub, to the context.
+//
+// clientAuthorize is optional: when set, the requests with a valid token are also sent to the
+// remote authorization, configured by opts, for the checks that are not done locally. With
+// WithOptionalToken, the requests without a token are passed through with no principal.
+func Authentication(verifier *jwt.Verifier, clientAuthorize *client.Client, opts ...AuthorizationOption) echo.MiddlewareFunc {
+	o := newAuthorizationOptions(opts...)
+
+	var authorizer *remoteAuthorizer
+	if clientAuthorize != nil {
+		authorizer = newRemoteAuthorizer(clientAuthorize, opts...)
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+
+			token := bearerToken(c.Request().Header.Get("Authorization"))
+			if token == "" && o.optionalToken {
+				return next(c)
+			}
+			if token == "" {
+				return c.JSON(http.StatusUnauthorized, Resp{
+					ErrorCode:   ErrAuthentication,
+					Message:     "Authentication failed",
+					Description: "Token is empty",
+				})
+			}
+
+			principal, err := verifier.VerifyPrincipal(ctx, token)
+			if errors.Is(err, jwt.ErrTokenStoreUnavailable) {
+				logger.GetLogger().AddTraceInfoContextRequest(ctx).Err(err).Msg("verify token failed")
+				return c.JSON(http.StatusServiceUnavailable, Resp{
+					ErrorCode:   ErrServiceUnavailable,
+					Message:     "Authentication unavailable",
+					Description: "Token could not be verified, try again later",
+				})
+			}
+			if err != nil {
+				logger.GetLogger().AddTraceInfoContextRequest(ctx).Warn().Err(err).Msg("verify token failed")
+				return c.JSON(http.StatusUnauthorized, Resp{
+					ErrorCode:   ErrAuthentication,
+					Message:     "Authentication failed",
+					Description: tokenErrorDescription(err),
+				})
+			}
+
+			if authorizer != nil {
+				var ok bool
+				if ctx, ok, err = authorizer.authorize(c, ctx, token); !ok {
+					return err
+				}
+			}
+
+			ctx = contextWithPrincipal(ctx, principal)
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			return next(c)
+		}
+	}
+}
+
+func contextWithPrincipal(ctx context.Context, principal *jwt.Principal) context.Context {
+	ctx = jwt.ContextWithPrincipal(ctx, principal)
+	if principal.Subject != "" {
+		ctx = context.WithValue(ctx, utils.JwtSub, principal.Subject)
+	}
+	return ctx
+}
+
+// tokenErrorDescription describes why a token is rejected, without the details of the
+// verification.
+func tokenErrorDescription(err error) string {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return "Token expired"
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return "Token not valid yet"
+	case errors.Is(err, jwt.ErrTokenRevoked):
+		return "Token revoked"
+	default:
+		return "Token invalid"
+	}
+}
@@ -0,0 +1,166 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go-source/pkg/jwt"
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+)
+
+func newTestIssuer(t *testing.T) *jwt.Issuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := jwt.JwtConfig{
+		Alg:        jwt.ES256,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		Expire:     time.Minute,
+		Issuer:     "auth",
+	}
+	j, err := jwt.NewJWT(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwt.NewIssuer(j, cfg)
+}
+
+func TestAuthentication(t *testing.T) {
+	logger.InitLog("middlewares-test")
+	issuer := newTestIssuer(t)
+
+	valid, err := issuer.Issue(map[string]interface{}{"sub": "user", "type": utils.IASTypeClient, "roles": []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, err := issuer.Issue(map[string]interface{}{"sub": "user", "exp": time.Now().Add(-time.Minute).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// same claims, signed by another key
+	forged, err := newTestIssuer(t).Issue(map[string]interface{}{"sub": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{name: "valid", token: valid, wantStatus: http.StatusOK},
+		{name: "empty", token: "", wantStatus: http.StatusUnauthorized},
+		{name: "expired", token: expired, wantStatus: http.StatusUnauthorized},
+		{name: "forged", token: forged, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.Use(Authentication(issuer.Verifier(), nil))
+			e.GET("/", func(c echo.Context) error {
+				principal, ok := jwt.PrincipalFromContext(c.Request().Context())
+				if !ok || principal.Subject != "user" || principal.Type != utils.IASTypeClient || !principal.HasRole("admin") {
+					t.Errorf("principal = %+v", principal)
+				}
+				return c.NoContent(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+		})
+	}
+
+	interceptor := UnaryAuthentication(issuer.Verifier())
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		principal, _ := jwt.PrincipalFromContext(ctx)
+		return principal.Subject, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+valid))
+	if sub, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil || sub != "user" {
+		t.Fatalf("interceptor() = %v, %v", sub, err)
+	}
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+expired))
+	if _, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("interceptor(expired) err = %v, want Unauthenticated", err)
+	}
+}
+
+// downTokenStore fails like a token store whose backend is down.
+type downTokenStore struct{}
+
+func (downTokenStore) Revoke(ctx context.Context, id string, exp time.Time) error {
+	return errors.New("connection refused")
+}
+
+func (downTokenStore) IsRevoked(ctx context.Context, ids ...string) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func (downTokenStore) Use(ctx context.Context, jti string, exp time.Time) (bool, error) {
+	return false, errors.New("connection refused")
+}
+
+func TestAuthenticationTokenStoreUnavailable(t *testing.T) {
+	logger.InitLog("middlewares-test")
+	issuer := newTestIssuer(t)
+	verifier := issuer.Verifier(jwt.WithTokenStore(downTokenStore{}))
+
+	token, err := issuer.Issue(map[string]interface{}{"sub": "user"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(Authentication(verifier, nil))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", rec.Code)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	if _, err := UnaryAuthentication(verifier)(ctx, nil, &grpc.UnaryServerInfo{}, handler); status.Code(err) != codes.Unavailable {
+		t.Fatalf("interceptor() err = %v, want Unavailable", err)
+	}
+}
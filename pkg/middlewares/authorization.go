@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"go-source/pkg/client"
 	"go-source/pkg/jwt"
+	logger "go-source/pkg/log"
 	"go-source/pkg/utils"
 	"net/http"
 	"strings"
@@ -13,13 +14,50 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func Authorization(clientAuthorize *client.Client) echo.MiddlewareFunc {
+type authorizationOptions struct {
+	cache         *AuthorizationCacheConfig
+	optionalToken bool
+}
+
+// AuthorizationOption configures the remote authorization of Authorization and Authentication.
+type AuthorizationOption func(o *authorizationOptions)
+
+// WithDecisionCache reuses the decisions of the remote authorization for the same token,
+// method and route template, and coalesces the identical concurrent calls.
+func WithDecisionCache(cfg AuthorizationCacheConfig) AuthorizationOption {
+	return func(o *authorizationOptions) {
+		o.cache = &cfg
+	}
+}
+
+// WithOptionalToken lets Authentication, UnaryAuthentication and StreamAuthentication pass the
+// requests without a token through with no jwt.Principal, for a later authorization, such as
+// a policy.Engine, to decide. The requests with an invalid token are still rejected.
+func WithOptionalToken() AuthorizationOption {
+	return func(o *authorizationOptions) {
+		o.optionalToken = true
+	}
+}
+
+func newAuthorizationOptions(opts ...AuthorizationOption) *authorizationOptions {
+	o := &authorizationOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// Authorization asks clientAuthorize to authenticate and authorize every request. The sub of
+// the token is set to the context once the token is accepted.
+func Authorization(clientAuthorize *client.Client, opts ...AuthorizationOption) echo.MiddlewareFunc {
+	authorizer := newRemoteAuthorizer(clientAuthorize, opts...)
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			ctx := c.Request().Context()
 
 			// get token
-			token := c.Request().Header.Get("Authorization")
+			token := bearerToken(c.Request().Header.Get("Authorization"))
 			if token == "" {
 				return c.JSON(http.StatusUnauthorized, Resp{
 					ErrorCode:   ErrAuthentication,
@@ -28,80 +66,183 @@ func Authorization(clientAuthorize *client.Client) echo.MiddlewareFunc {
 				})
 			}
 
-			// parse token
-			var claims map[string]interface{}
-			err := jwt.ParseClaims(strings.TrimPrefix(token, "Bearer "), &claims)
-			if err == nil {
-				// check expired
-				exp, ok := claims[utils.JwtExp].(int64)
-				if ok && time.Now().Unix() > exp {
-					return c.JSON(http.StatusUnauthorized, Resp{
-						ErrorCode:   ErrAuthentication,
-						Message:     "Authentication failed",
-						Description: "Token expired",
-					})
-				}
+			ctx, ok, err := authorizer.authorize(c, ctx, token)
+			if !ok {
+				return err
+			}
 
-				// get sub
-				sub, ok := claims[utils.JwtSub].(string)
-				if ok {
-					// set sub to context
+			// the claims are read once the token is accepted, the signature is not checked here
+			var claims map[string]interface{}
+			if err := jwt.ParseClaims(token, &claims); err == nil {
+				if sub, ok := claims[utils.JwtSub].(string); ok {
 					ctx = context.WithValue(ctx, utils.JwtSub, sub)
 				}
 			}
 
-			body := map[string]interface{}{
-				"type":   "API",
-				"method": c.Request().Method,
-				"url":    c.Request().URL.String(),
-			}
+			// set ctx to request context
+			c.SetRequest(c.Request().WithContext(ctx))
 
-			reqHeader := make(map[string][]string)
-			for k, v := range c.Request().Header {
-				reqHeader[k] = v
-			}
-			reqHeader["Content-Type"] = []string{"application/json"}
-			reqHeader["Accept-Encoding"] = []string{"gzip"}
-
-			// call authenticate and authorize: request header is c.Request().Header
-			res, err := clientAuthorize.R().SetContext(ctx).SetBody(body).SetHeaderMultiValues(reqHeader).Post("")
-			if err != nil {
-				var respBody Resp
-				if len(res.Body()) > 0 {
-					if err := json.Unmarshal(res.Body(), &respBody); err != nil {
-						return c.JSON(http.StatusUnauthorized, Resp{
-							ErrorCode:   ErrAuthentication,
-							Message:     "Authentication failed",
-							Description: err.Error(),
-						})
-					}
-				}
+			return next(c)
+		}
+	}
+}
+
+// remoteAuthorizer calls the authorization service, through its decision cache when set.
+type remoteAuthorizer struct {
+	client *client.Client
+	cache  *decisionCache
+}
 
-				if respBody.Message == "" {
-					return c.JSON(http.StatusUnauthorized, Resp{
+func newRemoteAuthorizer(clientAuthorize *client.Client, opts ...AuthorizationOption) *remoteAuthorizer {
+	o := newAuthorizationOptions(opts...)
+
+	a := &remoteAuthorizer{client: clientAuthorize}
+	if o.cache != nil {
+		a.cache = newDecisionCache(*o.cache)
+	}
+	return a
+}
+
+// authorize asks the authorization service whether the request is allowed. It returns false
+// once it wrote the response of a denied request, with the error of writing it.
+func (a *remoteAuthorizer) authorize(c echo.Context, ctx context.Context, token string) (context.Context, bool, error) {
+	var decision authDecision
+	if a.cache == nil {
+		decision, _ = a.call(c, ctx)
+	} else {
+		decision = a.cachedCall(c, ctx, token)
+	}
+
+	if !decision.allowed {
+		return ctx, false, c.JSON(decision.status, decision.resp)
+	}
+
+	if decision.me != "" {
+		// set me to context
+		ctx = context.WithValue(ctx, utils.HeaderXMeProfile, decision.me)
+	}
+	return ctx, true, nil
+}
+
+func (a *remoteAuthorizer) cachedCall(c echo.Context, ctx context.Context, token string) authDecision {
+	route := c.Path()
+	if route == "" {
+		// no route matched
+		route = c.Request().URL.Path
+	}
+	key := decisionKey(token, c.Request().Method, route)
+
+	cached, fresh, stale := a.cache.get(key)
+	if fresh {
+		return cached
+	}
+
+	type result struct {
+		decision    authDecision
+		unavailable bool
+	}
+	v, _, _ := a.cache.group.Do(key, func() (interface{}, error) {
+		// the call is shared by the coalesced requests, it must outlive the one starting it
+		decision, unavailable := a.call(c, context.WithoutCancel(ctx))
+		if !unavailable {
+			a.cache.set(key, decision, tokenExpiresAt(token))
+		}
+		return result{decision: decision, unavailable: unavailable}, nil
+	})
+	res := v.(result)
+
+	if res.unavailable && stale {
+		logger.GetLogger().AddTraceInfoContextRequest(ctx).Warn().
+			Int("status", res.decision.status).
+			Msg("authorization service failed, using the previous decision")
+		return cached
+	}
+	return res.decision
+}
+
+// call sends the request to the authorization service. unavailable is set when the service
+// failed to decide: the call failed, or the service answered a 408, a 429 or a 5xx.
+func (a *remoteAuthorizer) call(c echo.Context, ctx context.Context) (decision authDecision, unavailable bool) {
+	body := map[string]interface{}{
+		"type":   "API",
+		"method": c.Request().Method,
+		"url":    c.Request().URL.String(),
+	}
+
+	reqHeader := make(map[string][]string)
+	for k, v := range c.Request().Header {
+		reqHeader[k] = v
+	}
+	reqHeader["Content-Type"] = []string{"application/json"}
+	reqHeader["Accept-Encoding"] = []string{"gzip"}
+
+	// call authenticate and authorize: request header is c.Request().Header
+	res, err := a.client.R().SetContext(ctx).SetBody(body).SetHeaderMultiValues(reqHeader).Post("")
+	if err != nil {
+		unavailable = res == nil || serviceUnavailable(res.StatusCode())
+
+		var respBody Resp
+		if res != nil && len(res.Body()) > 0 {
+			if err := json.Unmarshal(res.Body(), &respBody); err != nil {
+				return authDecision{
+					status: http.StatusUnauthorized,
+					resp: Resp{
 						ErrorCode:   ErrAuthentication,
 						Message:     "Authentication failed",
 						Description: err.Error(),
-					})
-				}
-
-				return c.JSON(res.StatusCode(), Resp{
-					ErrorCode:   respBody.ErrorCode,
-					Message:     respBody.Message,
-					Description: respBody.Description,
-				})
+					},
+				}, unavailable
 			}
+		}
 
-			me := res.Header().Get(utils.HeaderXMeProfile)
-			if me != "" {
-				// set me to context
-				ctx = context.WithValue(ctx, utils.HeaderXMeProfile, me)
-			}
+		if respBody.Message == "" {
+			return authDecision{
+				status: http.StatusUnauthorized,
+				resp: Resp{
+					ErrorCode:   ErrAuthentication,
+					Message:     "Authentication failed",
+					Description: err.Error(),
+				},
+			}, unavailable
+		}
 
-			// set ctx to request context
-			c.SetRequest(c.Request().WithContext(ctx))
+		return authDecision{
+			status: res.StatusCode(),
+			resp: Resp{
+				ErrorCode:   respBody.ErrorCode,
+				Message:     respBody.Message,
+				Description: respBody.Description,
+			},
+		}, unavailable
+	}
 
-			return next(c)
-		}
+	return authDecision{allowed: true, me: res.Header().Get(utils.HeaderXMeProfile)}, false
+}
+
+// serviceUnavailable reports whether the authorization service answered status without
+// deciding, so that the answer must not be cached as a denial.
+func serviceUnavailable(status int) bool {
+	switch status {
+	case 0, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return true
+	}
+	return status >= http.StatusInternalServerError
+}
+
+// tokenExpiresAt reads the exp of token, without checking its signature: it only shortens
+// the time a decision is cached. It is zero when the token has no exp.
+func tokenExpiresAt(token string) time.Time {
+	var claims jwt.StandardClaims
+	if err := jwt.ParseClaims(token, &claims); err != nil {
+		return time.Time{}
+	}
+	return claims.ExpiresAtTime()
+}
+
+// bearerToken returns the token of an Authorization header, empty when there is none.
+func bearerToken(header string) string {
+	if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
 	}
+	return strings.TrimSpace(header)
 }
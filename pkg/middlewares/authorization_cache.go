@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const defaultAuthorizationCacheTTL = 30 * time.Second
+
+// authDecision is the answer of the remote authorization to a request.
+type authDecision struct {
+	allowed bool
+	// me is the X-Me-Profile header of an allowed request
+	me string
+	// status and resp are the response of a denied request
+	status int
+	resp   Resp
+}
+
+type decisionEntry struct {
+	decision   authDecision
+	expiresAt  time.Time
+	staleUntil time.Time
+}
+
+// decisionCache keeps the decisions by token hash, method and route template. The decisions
+// of a route are then expected not to depend on its path params or query.
+type decisionCache struct {
+	cfg       AuthorizationCacheConfig
+	entries   map[string]decisionEntry
+	group     singleflight.Group
+	lastSweep time.Time
+	mu        sync.Mutex
+}
+
+func newDecisionCache(cfg AuthorizationCacheConfig) *decisionCache {
+	if cfg.TTL <= 0 {
+		cfg.TTL = defaultAuthorizationCacheTTL
+	}
+
+	return &decisionCache{
+		cfg:       cfg,
+		entries:   make(map[string]decisionEntry),
+		lastSweep: time.Now(),
+	}
+}
+
+func decisionKey(token, method, route string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:]) + " " + method + " " + route
+}
+
+// get returns the decision of key, and whether it is still fresh or only usable while the
+// authorization service fails.
+func (dc *decisionCache) get(key string) (decision authDecision, fresh bool, stale bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	entry, ok := dc.entries[key]
+	if !ok {
+		return authDecision{}, false, false
+	}
+
+	now := time.Now()
+	return entry.decision, now.Before(entry.expiresAt), now.Before(entry.staleUntil)
+}
+
+// set keeps decision until the TTL or tokenExp, the earliest, and for StaleIfError more
+// within tokenExp. tokenExp is zero for the tokens without exp.
+func (dc *decisionCache) set(key string, decision authDecision, tokenExp time.Time) {
+	now := time.Now()
+
+	expiresAt := now.Add(dc.cfg.TTL)
+	staleUntil := expiresAt.Add(dc.cfg.StaleIfError)
+	if !tokenExp.IsZero() {
+		if tokenExp.Before(expiresAt) {
+			expiresAt = tokenExp
+		}
+		if tokenExp.Before(staleUntil) {
+			staleUntil = tokenExp
+		}
+	}
+	if !now.Before(expiresAt) {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if now.Sub(dc.lastSweep) > dc.cfg.TTL {
+		for k, entry := range dc.entries {
+			if now.After(entry.staleUntil) {
+				delete(dc.entries, k)
+			}
+		}
+		dc.lastSweep = now
+	}
+
+	if _, ok := dc.entries[key]; !ok && dc.cfg.MaxEntries > 0 && len(dc.entries) >= dc.cfg.MaxEntries {
+		return
+	}
+	dc.entries[key] = decisionEntry{decision: decision, expiresAt: expiresAt, staleUntil: staleUntil}
+}
@@ -0,0 +1,113 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"go-source/pkg/client/clienttest"
+	logger "go-source/pkg/log"
+)
+
+func TestAuthorizationDecisionCache(t *testing.T) {
+	logger.InitLog("middlewares-test")
+
+	auth := clienttest.NewFake()
+	defer auth.Close()
+
+	var mu sync.Mutex
+	status := http.StatusOK
+	auth.Handle(http.MethodPost, "/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		if status == http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"errorCode":4030,"message":"Denied","description":"denied"}`))
+	})
+	setStatus := func(s int) {
+		mu.Lock()
+		status = s
+		mu.Unlock()
+	}
+
+	e := echo.New()
+	e.Use(Authorization(auth.Client(), WithDecisionCache(AuthorizationCacheConfig{
+		TTL:          100 * time.Millisecond,
+		StaleIfError: time.Minute,
+	})))
+	e.GET("/users/:id", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(token, path string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// concurrent identical checks are coalesced, and the decision is reused for the route
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if code := serve("token-a", "/users/1"); code != http.StatusOK {
+				t.Errorf("status = %d, want 200", code)
+			}
+		}()
+	}
+	wg.Wait()
+	if code := serve("token-a", "/users/2"); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+	if n := len(auth.Requests()); n != 1 {
+		t.Fatalf("authorization calls = %d, want 1", n)
+	}
+
+	// the decision expired: the service failure is hidden by the previous decision
+	time.Sleep(150 * time.Millisecond)
+	setStatus(http.StatusServiceUnavailable)
+	if code := serve("token-a", "/users/1"); code != http.StatusOK {
+		t.Fatalf("stale status = %d, want 200", code)
+	}
+	if code := serve("token-b", "/users/1"); code != http.StatusServiceUnavailable {
+		t.Fatalf("status without decision = %d, want 503", code)
+	}
+
+	// denials are decisions too
+	setStatus(http.StatusForbidden)
+	calls := len(auth.Requests())
+	for i := 0; i < 2; i++ {
+		if code := serve("token-c", "/users/1"); code != http.StatusForbidden {
+			t.Fatalf("denied status = %d, want 403", code)
+		}
+	}
+	if n := len(auth.Requests()) - calls; n != 1 {
+		t.Fatalf("authorization calls = %d, want 1", n)
+	}
+
+	// a throttled or timed out call is not a decision
+	for _, s := range []int{http.StatusTooManyRequests, http.StatusRequestTimeout} {
+		setStatus(s)
+		calls = len(auth.Requests())
+		for i := 0; i < 2; i++ {
+			if code := serve("token-d", "/users/1"); code != s {
+				t.Fatalf("status = %d, want %d", code, s)
+			}
+		}
+		if n := len(auth.Requests()) - calls; n != 2 {
+			t.Fatalf("authorization calls after %d = %d, want 2", s, n)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package middlewares
+
+import (
+	"time"
+
+	"go-source/pkg/breaker"
+)
+
+type RateLimitConfig struct {
+	// ExpectedInstances is used to size the local fallback bucket: global rate / instances.
+	ExpectedInstances int            `env:"EXPECTED_INSTANCES" envDefault:"1"`
+	Breaker           breaker.Config `envPrefix:"BREAKER_"`
+}
+
+// AuthorizationCacheConfig caches the decisions of the remote authorization, see
+// WithDecisionCache.
+type AuthorizationCacheConfig struct {
+	// TTL bounds the time a decision is reused. The exp of the token bounds it too.
+	TTL time.Duration `env:"TTL" envDefault:"30s"`
+	// StaleIfError is the time an expired decision is still used while the authorization
+	// service fails, so that its short outages do not fail the requests.
+	StaleIfError time.Duration `env:"STALE_IF_ERROR" envDefault:"5m"`
+	MaxEntries   int           `env:"MAX_ENTRIES" envDefault:"10000"`
+}
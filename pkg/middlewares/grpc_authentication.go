@@ -0,0 +1,81 @@
+package middlewares
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go-source/pkg/jwt"
+	logger "go-source/pkg/log"
+)
+
+// UnaryAuthentication is the gRPC interceptor of Authentication: it verifies the access token
+// of the authorization metadata and sets its jwt.Principal to the context. Of opts, only
+// WithOptionalToken applies.
+func UnaryAuthentication(verifier *jwt.Verifier, opts ...AuthorizationOption) grpc.UnaryServerInterceptor {
+	o := newAuthorizationOptions(opts...)
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticateGRPC(ctx, verifier, o.optionalToken)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthentication is the stream interceptor of UnaryAuthentication.
+func StreamAuthentication(verifier *jwt.Verifier, opts ...AuthorizationOption) grpc.StreamServerInterceptor {
+	o := newAuthorizationOptions(opts...)
+
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticateGRPC(ss.Context(), verifier, o.optionalToken)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticateGRPC(ctx context.Context, verifier *jwt.Verifier, optionalToken bool) (context.Context, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token = bearerToken(values[0])
+		}
+	}
+	if token == "" && optionalToken {
+		return ctx, nil
+	}
+	if token == "" {
+		return ctx, status.Error(codes.Unauthenticated, "Token is empty")
+	}
+
+	principal, err := verifier.VerifyPrincipal(ctx, token)
+	if errors.Is(err, jwt.ErrTokenStoreUnavailable) {
+		logger.GetLogger().AddTraceInfoContextRequest(ctx).Err(err).Msg("verify token failed")
+		return ctx, status.Error(codes.Unavailable, "Token could not be verified, try again later")
+	}
+	if err != nil {
+		logger.GetLogger().AddTraceInfoContextRequest(ctx).Warn().Err(err).Msg("verify token failed")
+		return ctx, status.Error(codes.Unauthenticated, tokenErrorDescription(err))
+	}
+
+	return contextWithPrincipal(ctx, principal), nil
+}
+
+// contextServerStream replaces the context of a stream.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
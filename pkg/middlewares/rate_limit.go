@@ -1,22 +1,108 @@
 package middlewares
 
 import (
+	"context"
+	"errors"
+	"go-source/pkg/breaker"
 	"go-source/pkg/database/redis"
 	logger "go-source/pkg/log"
+	"go-source/pkg/metric"
 	"go-source/pkg/utils"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis_rate/v10"
+	goredis "github.com/redis/go-redis/v9"
 
 	"github.com/labstack/echo/v4"
 )
 
-func RateLimit(period, rate int) echo.MiddlewareFunc {
+type RateLimitFailMode int
+
+const (
+	// RateLimitFailLocal falls back to the in-process token bucket while Redis is unavailable.
+	RateLimitFailLocal RateLimitFailMode = iota
+	// RateLimitFailOpen lets every request through while Redis is unavailable.
+	RateLimitFailOpen
+	// RateLimitFailClosed rejects every request while Redis is unavailable.
+	RateLimitFailClosed
+)
+
+type RateLimitOption func(o *rateLimitOptions)
+
+type rateLimitOptions struct {
+	failMode RateLimitFailMode
+}
+
+func WithRateLimitFailMode(mode RateLimitFailMode) RateLimitOption {
+	return func(o *rateLimitOptions) {
+		o.failMode = mode
+	}
+}
+
+// RateLimiter limits requests through Redis and degrades to a local limiter when Redis is down.
+// Redis is retried on the circuit breaker schedule.
+type RateLimiter struct {
+	instances int
+	breaker   *breaker.Breaker
+	local     *localLimiter
+	// redisClient returns the shared Redis client, nil until it is connected.
+	redisClient func() goredis.UniversalClient
+}
+
+var (
+	rateLimiter     *RateLimiter
+	rateLimiterOnce sync.Once
+)
+
+func NewRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	if cfg.ExpectedInstances <= 0 {
+		cfg.ExpectedInstances = 1
+	}
+
+	return &RateLimiter{
+		instances: cfg.ExpectedInstances,
+		breaker:   breaker.New("rate_limit_redis", cfg.Breaker, breaker.WithOnStateChange(logBreakerStateChange)),
+		local:     newLocalLimiter(),
+
+		redisClient: getRedisClient,
+	}
+}
+
+// InitRateLimiter configures the limiter used by RateLimit. It must be called before routes are registered.
+func InitRateLimiter(cfg RateLimitConfig) *RateLimiter {
+	rateLimiterOnce.Do(func() {
+		rateLimiter = NewRateLimiter(cfg)
+	})
+	return rateLimiter
+}
+
+func getRateLimiter() *RateLimiter {
+	return InitRateLimiter(RateLimitConfig{})
+}
+
+func RateLimit(period, rate int, opts ...RateLimitOption) echo.MiddlewareFunc {
+	return getRateLimiter().Middleware(period, rate, opts...)
+}
+
+func (rl *RateLimiter) Middleware(period, rate int, opts ...RateLimitOption) echo.MiddlewareFunc {
+	if period == 0 {
+		period = 1
+	}
+
+	options := &rateLimitOptions{failMode: RateLimitFailLocal}
+	for _, o := range opts {
+		o(options)
+	}
+
+	limit := redis_rate.Limit{
+		Rate:   rate,
+		Burst:  rate,
+		Period: time.Second * time.Duration(period),
+	}
+
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			if period == 0 {
-				period = 1
-			}
 			ctx := c.Request().Context()
 			log := logger.GetLogger().AddTraceInfoContextRequest(ctx)
 			keyRateLimit := c.Request().Context().Value(utils.KeyRateLimit)
@@ -28,17 +114,13 @@ func RateLimit(period, rate int) echo.MiddlewareFunc {
 				log.Info().Msg("key-limit is empty")
 				return echo.ErrTooManyRequests
 			}
-			limiter := redis_rate.NewLimiter(redis.GetInstance().GetClient())
-			result, err := limiter.Allow(ctx, keyRateLimit.(string), redis_rate.Limit{
-				Rate:   rate,
-				Burst:  rate,
-				Period: time.Second * time.Duration(period),
-			})
+
+			allowed, err := rl.allow(ctx, keyRateLimit.(string), limit, options.failMode)
 			if err != nil {
 				return err
 			}
 
-			if result.Allowed == 0 {
+			if !allowed {
 				return echo.ErrTooManyRequests
 			}
 
@@ -46,3 +128,59 @@ func RateLimit(period, rate int) echo.MiddlewareFunc {
 		}
 	}
 }
+
+func (rl *RateLimiter) allow(ctx context.Context, key string, limit redis_rate.Limit, failMode RateLimitFailMode) (bool, error) {
+	log := logger.GetLogger().AddTraceInfoContextRequest(ctx)
+
+	if client := rl.redisClient(); client != nil {
+		if err := rl.breaker.Allow(); err == nil {
+			result, err := redis_rate.NewLimiter(client).Allow(ctx, key, limit)
+			if errors.Is(err, context.Canceled) {
+				rl.breaker.Done(nil)
+				return false, err
+			}
+
+			rl.breaker.Done(err)
+			if err == nil {
+				return result.Allowed > 0, nil
+			}
+
+			log.Warn().Err(err).Msg("redis rate limit failed, using fallback")
+		}
+	}
+
+	switch failMode {
+	case RateLimitFailOpen:
+		return true, nil
+	case RateLimitFailClosed:
+		return false, echo.ErrServiceUnavailable
+	default:
+		return rl.local.Allow(key, rl.localRate(limit.Rate), limit.Period), nil
+	}
+}
+
+// localRate is the share of the global rate this instance may grant on its own.
+func (rl *RateLimiter) localRate(rate int) int {
+	local := rate / rl.instances
+	if local < 1 {
+		local = 1
+	}
+	return local
+}
+
+func getRedisClient() goredis.UniversalClient {
+	instance := redis.GetInstance()
+	if instance == nil {
+		return nil
+	}
+	return instance.GetClient()
+}
+
+func logBreakerStateChange(name string, from, to breaker.State) {
+	metric.RecordCircuitBreakerState(metric.HttpComponent, name, int64(to))
+	logger.GetLogger().Warn().
+		Str("breaker", name).
+		Str("from", from.String()).
+		Str("to", to.String()).
+		Msg("circuit breaker state changed")
+}
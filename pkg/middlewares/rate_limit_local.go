@@ -0,0 +1,56 @@
+package middlewares
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const localLimiterIdleTTL = 10 * time.Minute
+
+type localBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// localLimiter is an in-process token bucket per key, used while Redis is unavailable.
+type localLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*localBucket
+	lastSweep time.Time
+}
+
+func newLocalLimiter() *localLimiter {
+	return &localLimiter{
+		buckets:   make(map[string]*localBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (l *localLimiter) Allow(key string, limit int, period time.Duration) bool {
+	now := time.Now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > localLimiterIdleTTL {
+		for k, b := range l.buckets {
+			if now.Sub(b.lastSeen) > localLimiterIdleTTL {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	bucketKey := fmt.Sprintf("%s:%d:%d", key, limit, period)
+	b, ok := l.buckets[bucketKey]
+	if !ok {
+		b = &localBucket{limiter: rate.NewLimiter(rate.Every(period/time.Duration(limit)), limit)}
+		l.buckets[bucketKey] = b
+	}
+	b.lastSeen = now
+
+	return b.limiter.AllowN(now, 1)
+}
@@ -0,0 +1,116 @@
+package middlewares
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	goredis "github.com/redis/go-redis/v9"
+
+	"go-source/pkg/breaker"
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+)
+
+// newUnavailableRateLimiter returns a limiter whose Redis refuses every connection.
+func newUnavailableRateLimiter(t *testing.T, cfg RateLimitConfig) *RateLimiter {
+	t.Helper()
+
+	client := goredis.NewClient(&goredis.Options{Addr: "127.0.0.1:1", MaxRetries: -1, DialTimeout: 100 * time.Millisecond})
+	t.Cleanup(func() { _ = client.Close() })
+
+	rl := NewRateLimiter(cfg)
+	rl.redisClient = func() goredis.UniversalClient { return client }
+	return rl
+}
+
+func serveRateLimited(rl *RateLimiter, rate int, opts ...RateLimitOption) func() int {
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := context.WithValue(c.Request().Context(), utils.KeyRateLimit, "client-1")
+			c.SetRequest(c.Request().WithContext(ctx))
+			return next(c)
+		}
+	})
+	e.Use(rl.Middleware(60, rate, opts...))
+	e.GET("/", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	return func() int {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec.Code
+	}
+}
+
+func TestRateLimiterFallsBackToLocalBucket(t *testing.T) {
+	logger.InitLog("middlewares-test")
+
+	rl := newUnavailableRateLimiter(t, RateLimitConfig{
+		ExpectedInstances: 2,
+		Breaker:           breaker.Config{FailureThreshold: 1, OpenTimeout: time.Minute},
+	})
+	serve := serveRateLimited(rl, 4)
+
+	// the first request opens the breaker, then this instance grants its share: 4 / 2
+	for i := 0; i < 2; i++ {
+		if code := serve(); code != http.StatusOK {
+			t.Fatalf("request %d status = %d, want 200", i, code)
+		}
+	}
+	if state := rl.breaker.State(); state != breaker.StateOpen {
+		t.Fatalf("breaker state = %s, want open", state)
+	}
+	if code := serve(); code != http.StatusTooManyRequests {
+		t.Fatalf("status over the local rate = %d, want 429", code)
+	}
+}
+
+func TestRateLimiterFailModes(t *testing.T) {
+	logger.InitLog("middlewares-test")
+
+	tests := []struct {
+		name       string
+		mode       RateLimitFailMode
+		wantStatus int
+	}{
+		{name: "fail open", mode: RateLimitFailOpen, wantStatus: http.StatusOK},
+		{name: "fail closed", mode: RateLimitFailClosed, wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rl := newUnavailableRateLimiter(t, RateLimitConfig{Breaker: breaker.Config{FailureThreshold: 1, OpenTimeout: time.Minute}})
+			serve := serveRateLimited(rl, 1, WithRateLimitFailMode(tt.mode))
+
+			// beyond the rate, the local bucket would have rejected them
+			for i := 0; i < 3; i++ {
+				if code := serve(); code != tt.wantStatus {
+					t.Fatalf("request %d status = %d, want %d", i, code, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimiterLocalRate(t *testing.T) {
+	tests := []struct {
+		rate, instances, want int
+	}{
+		{rate: 100, instances: 1, want: 100},
+		{rate: 100, instances: 4, want: 25},
+		{rate: 10, instances: 3, want: 3},
+		{rate: 2, instances: 5, want: 1},
+		{rate: 100, instances: 0, want: 100},
+	}
+	for _, tt := range tests {
+		rl := NewRateLimiter(RateLimitConfig{ExpectedInstances: tt.instances})
+		if got := rl.localRate(tt.rate); got != tt.want {
+			t.Errorf("localRate(%d) with %d instances = %d, want %d", tt.rate, tt.instances, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 func AddExtraDataForRequestContext(next echo.HandlerFunc) echo.HandlerFunc {
@@ -30,12 +31,16 @@ func AddExtraDataForRequestContext(next echo.HandlerFunc) echo.HandlerFunc {
 		// set request_id to response
 		c.Response().Header().Set(echo.HeaderXRequestID, reqID)
 
-		// set trace_info to context
+		// set trace_info and the W3C trace context of the request to context
 		traceInfo := utils.TraceInfo{RequestID: reqID}
 		ctx := c.Request().Context()
 		ctxTraceInfo := context.WithValue(ctx, utils.KeyTraceInfo, traceInfo)
+		ctxTraceInfo = utils.ExtractTraceContext(ctxTraceInfo, propagation.HeaderCarrier(c.Request().Header))
 		c.SetRequest(c.Request().WithContext(ctxTraceInfo))
 
+		// return the trace context, so callers can find the trace of the request
+		utils.InjectTraceContext(ctxTraceInfo, propagation.HeaderCarrier(c.Response().Header()))
+
 		return next(c)
 	}
 }
@@ -15,8 +15,12 @@ const (
 
 	ErrIASAuthentication = 4020
 
+	ErrPermissionDenied = 4030
+
 	ErrRegionNotFound = 4911
 	ErrXTicketIdEmpty = 4912
 
 	ErrCheckSig = 4921
+
+	ErrServiceUnavailable = 5030
 )
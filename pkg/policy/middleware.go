@@ -0,0 +1,113 @@
+package policy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"go-source/pkg/jwt"
+	"go-source/pkg/middlewares"
+)
+
+// Middleware authorizes the Echo requests with the engine. It runs after the authentication
+// middleware, which sets the jwt.Principal, and after routing, for the route template.
+func (e *Engine) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+
+			attributes := map[string]string{
+				"method": req.Method,
+				"route":  c.Path(),
+				"path":   req.URL.Path,
+			}
+			for i, name := range c.ParamNames() {
+				attributes["param."+name] = c.ParamValues()[i]
+			}
+			for name, values := range req.URL.Query() {
+				attributes["query."+name] = values[0]
+			}
+			for name, values := range req.Header {
+				attributes["header."+strings.ToLower(name)] = values[0]
+			}
+
+			principal, _ := jwt.PrincipalFromContext(req.Context())
+			decision := e.Evaluate(req.Context(), principal, Request{
+				Route:      req.Method + " " + c.Path(),
+				Attributes: attributes,
+			})
+
+			if !decision.Authenticated {
+				return c.JSON(http.StatusUnauthorized, middlewares.Resp{
+					ErrorCode:   middlewares.ErrAuthentication,
+					Message:     "Authentication failed",
+					Description: "Token is empty",
+				})
+			}
+			if !decision.Allowed {
+				return c.JSON(http.StatusForbidden, middlewares.Resp{
+					ErrorCode:   middlewares.ErrPermissionDenied,
+					Message:     "Permission denied",
+					Description: "The request is not allowed by the policies of the route",
+				})
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// UnaryInterceptor authorizes the unary gRPC calls with the engine, after the authentication
+// interceptor.
+func (e *Engine) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := e.authorizeGRPC(ctx, info.FullMethod); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamInterceptor is the stream interceptor of UnaryInterceptor.
+func (e *Engine) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := e.authorizeGRPC(ss.Context(), info.FullMethod); err != nil {
+			return err
+		}
+
+		return handler(srv, ss)
+	}
+}
+
+func (e *Engine) authorizeGRPC(ctx context.Context, fullMethod string) error {
+	attributes := map[string]string{
+		"method": fullMethod,
+		"route":  fullMethod,
+		"path":   fullMethod,
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for name, values := range md {
+			if len(values) > 0 {
+				attributes["header."+name] = values[0]
+			}
+		}
+	}
+
+	principal, _ := jwt.PrincipalFromContext(ctx)
+	decision := e.Evaluate(ctx, principal, Request{Route: fullMethod, Attributes: attributes})
+
+	if !decision.Authenticated {
+		return status.Error(codes.Unauthenticated, "Token is empty")
+	}
+	if !decision.Allowed {
+		return status.Error(codes.PermissionDenied, "Permission denied")
+	}
+	return nil
+}
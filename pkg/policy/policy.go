@@ -0,0 +1,373 @@
+// Package policy authorizes the requests locally, from the policies of their routes: the roles,
+// scopes and IAS types required from the jwt.Principal, and conditions on the request.
+//
+// The policies are loaded from YAML:
+//
+//	defaultEffect: deny
+//	policies:
+//	  - name: health
+//	    routes: ["/v1/service-name/health"]
+//	    anonymous: true
+//	  - name: users-read
+//	    routes: ["GET /v1/users/:id", "/user.UserService/GetUser"]
+//	    roles: [admin, support]
+//	    scopes: [users:read]
+//	    iasTypes: [CLIENT, SERVICE]
+//	  - name: users-own-profile
+//	    routes: ["PUT /v1/users/:id"]
+//	    conditions:
+//	      - attribute: param.id
+//	        equalsClaim: sub
+//
+// or declared with the routes, see Engine.Declare and Engine.DeclareRoute.
+//
+// The engine runs after the authentication, which must let the requests without a token
+// through for the anonymous routes to be reached:
+//
+//	e.Use(middlewares.Authentication(verifier, nil, middlewares.WithOptionalToken()), engine.Middleware())
+package policy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+
+	"go-source/pkg/jwt"
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+)
+
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+var ErrInvalidPolicy = errors.New("policy invalid")
+
+var iasTypes = map[string]bool{
+	utils.IASTypeService:  true,
+	utils.IASTypeClient:   true,
+	utils.IASTypePublic:   true,
+	utils.IASTypeInternal: true,
+}
+
+// Config locates the policies of a service.
+type Config struct {
+	File string `env:"FILE"`
+	// Explain logs why every request is allowed or denied.
+	Explain bool `env:"EXPLAIN"`
+}
+
+// Rule is what a route requires from the caller. Every requirement set must be met.
+type Rule struct {
+	// Anonymous allows every request, with or without a principal.
+	Anonymous bool `yaml:"anonymous,omitempty"`
+	// Roles requires one of the roles.
+	Roles []string `yaml:"roles,omitempty"`
+	// Scopes requires all the scopes.
+	Scopes []string `yaml:"scopes,omitempty"`
+	// IASTypes requires the principal to be of one of the IAS types: utils.IASTypeService,
+	// IASTypeClient, IASTypePublic or IASTypeInternal.
+	IASTypes []string `yaml:"iasTypes,omitempty"`
+	// Conditions on the request attributes, all required.
+	Conditions []Condition `yaml:"conditions,omitempty"`
+}
+
+// Condition checks an attribute of the request: "method", "route", "path", "param.<name>",
+// "query.<name>" or "header.<lowercase name>". One of Equals, EqualsClaim or In is set.
+type Condition struct {
+	Attribute string `yaml:"attribute"`
+	Equals    string `yaml:"equals,omitempty"`
+	// EqualsClaim is a claim of the principal the attribute must equal, e.g. sub.
+	EqualsClaim string   `yaml:"equalsClaim,omitempty"`
+	In          []string `yaml:"in,omitempty"`
+}
+
+// Policy applies a rule to routes: "METHOD /path/:param" as registered in Echo, "/path/:param"
+// for every method, or the full method of a gRPC call, "/package.Service/Method".
+type Policy struct {
+	Name   string   `yaml:"name"`
+	Routes []string `yaml:"routes"`
+	Rule   `yaml:",inline"`
+}
+
+type file struct {
+	DefaultEffect Effect   `yaml:"defaultEffect"`
+	Policies      []Policy `yaml:"policies"`
+}
+
+// Request is what the policies are evaluated against, besides the principal.
+type Request struct {
+	// Route is "METHOD /path/:param" for Echo, the full method for gRPC.
+	Route      string
+	Attributes map[string]string
+}
+
+// Decision is the result of Engine.Evaluate.
+type Decision struct {
+	Allowed bool
+	// Authenticated is false when the request was denied for having no principal.
+	Authenticated bool
+	Reasons       []string
+}
+
+type Option func(e *Engine)
+
+// WithExplain logs why every request is allowed or denied.
+func WithExplain(explain bool) Option {
+	return func(e *Engine) {
+		e.explain = explain
+	}
+}
+
+// WithDefaultEffect decides the requests of the routes without policy. It defaults to
+// EffectDeny, and is overridden by the defaultEffect of a loaded file.
+func WithDefaultEffect(effect Effect) Option {
+	return func(e *Engine) {
+		e.defaultEffect = effect
+	}
+}
+
+// Engine evaluates the policies of the routes. A request is allowed when every policy of
+// its route allows it.
+type Engine struct {
+	defaultEffect Effect
+	explain       bool
+	policies      map[string][]Policy
+	mu            sync.RWMutex
+}
+
+func New(opts ...Option) *Engine {
+	e := &Engine{
+		defaultEffect: EffectDeny,
+		policies:      make(map[string][]Policy),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	return e
+}
+
+// Load returns an engine with the policies of the YAML data.
+func Load(data []byte, opts ...Option) (*Engine, error) {
+	var f file
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPolicy, err)
+	}
+
+	e := New(opts...)
+	switch f.DefaultEffect {
+	case "":
+	case EffectAllow, EffectDeny:
+		e.defaultEffect = f.DefaultEffect
+	default:
+		return nil, fmt.Errorf("%w: default effect %q", ErrInvalidPolicy, f.DefaultEffect)
+	}
+
+	for _, p := range f.Policies {
+		if err := e.Add(p); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// LoadFile returns an engine with the policies of the YAML file of cfg.
+func LoadFile(cfg Config, opts ...Option) (*Engine, error) {
+	data, err := os.ReadFile(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+
+	return Load(data, append([]Option{WithExplain(cfg.Explain)}, opts...)...)
+}
+
+// Add adds the policy p to its routes.
+func (e *Engine) Add(p Policy) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, route := range p.Routes {
+		e.policies[route] = append(e.policies[route], p)
+	}
+	return nil
+}
+
+// Declare adds the rule of a route when it is registered, besides the loaded policies.
+func (e *Engine) Declare(route string, rule Rule) error {
+	return e.Add(Policy{Name: route, Routes: []string{route}, Rule: rule})
+}
+
+// DeclareRoute declares the rule of an Echo route:
+//
+//	engine.DeclareRoute(e.GET("/v1/users/:id", handler), policy.Rule{Roles: []string{"admin"}})
+func (e *Engine) DeclareRoute(route *echo.Route, rule Rule) error {
+	return e.Declare(route.Method+" "+route.Path, rule)
+}
+
+// Evaluate decides whether principal, nil for the anonymous requests, is allowed to send req.
+func (e *Engine) Evaluate(ctx context.Context, principal *jwt.Principal, req Request) Decision {
+	decision := e.evaluate(principal, req)
+
+	if e.explain {
+		log := logger.GetLogger().AddTraceInfoContextRequest(ctx).Info()
+		if principal != nil {
+			log = log.Str("sub", principal.Subject).Str("ias_type", principal.Type)
+		}
+		log.Str("route", req.Route).
+			Bool("allowed", decision.Allowed).
+			Strs("reasons", decision.Reasons).
+			Msg("policy decision")
+	}
+
+	return decision
+}
+
+func (e *Engine) evaluate(principal *jwt.Principal, req Request) Decision {
+	policies := e.lookup(req.Route)
+	if len(policies) == 0 {
+		return Decision{
+			Allowed:       e.defaultEffect == EffectAllow,
+			Authenticated: true,
+			Reasons:       []string{fmt.Sprintf("no policy for the route, default effect %s", e.defaultEffect)},
+		}
+	}
+
+	decision := Decision{Allowed: true, Authenticated: true}
+	for _, p := range policies {
+		reason, allowed, authenticated := p.evaluate(principal, req.Attributes)
+		decision.Reasons = append(decision.Reasons, fmt.Sprintf("policy %s: %s", p.Name, reason))
+		if !allowed {
+			decision.Allowed = false
+			decision.Authenticated = authenticated
+			break
+		}
+	}
+
+	return decision
+}
+
+// lookup returns the policies of route, and the ones of its path for every method.
+func (e *Engine) lookup(route string) []Policy {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	policies := append([]Policy(nil), e.policies[route]...)
+	if method, path, ok := strings.Cut(route, " "); ok && method != "" {
+		policies = append(policies, e.policies[path]...)
+	}
+	return policies
+}
+
+func (p Policy) validate() error {
+	if len(p.Routes) == 0 {
+		return fmt.Errorf("%w: policy %s has no route", ErrInvalidPolicy, p.Name)
+	}
+	for _, t := range p.IASTypes {
+		if !iasTypes[t] {
+			return fmt.Errorf("%w: policy %s: unknown ias type %q", ErrInvalidPolicy, p.Name, t)
+		}
+	}
+	for _, c := range p.Conditions {
+		set := 0
+		for _, ok := range []bool{c.Equals != "", c.EqualsClaim != "", len(c.In) > 0} {
+			if ok {
+				set++
+			}
+		}
+		if c.Attribute == "" || set != 1 {
+			return fmt.Errorf("%w: policy %s: condition on %q needs one of equals, equalsClaim or in", ErrInvalidPolicy, p.Name, c.Attribute)
+		}
+	}
+	return nil
+}
+
+// evaluate returns why the rule allows or denies the request, and whether it was denied for
+// having no principal.
+func (r Rule) evaluate(principal *jwt.Principal, attributes map[string]string) (reason string, allowed, authenticated bool) {
+	if r.Anonymous {
+		return "anonymous allowed", true, true
+	}
+	if principal == nil {
+		return "no principal", false, false
+	}
+
+	if len(r.IASTypes) > 0 && !contains(r.IASTypes, principal.Type) {
+		return fmt.Sprintf("ias type %q is not one of %v", principal.Type, r.IASTypes), false, true
+	}
+
+	if len(r.Roles) > 0 {
+		found := false
+		for _, role := range r.Roles {
+			if principal.HasRole(role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Sprintf("none of the roles %v in %v", r.Roles, principal.Roles), false, true
+		}
+	}
+
+	for _, scope := range r.Scopes {
+		if !principal.HasScope(scope) {
+			return fmt.Sprintf("scope %q missing in %v", scope, []string(principal.Scopes)), false, true
+		}
+	}
+
+	for _, c := range r.Conditions {
+		if reason, ok := c.evaluate(principal, attributes); !ok {
+			return reason, false, true
+		}
+	}
+
+	return "requirements met", true, true
+}
+
+func (c Condition) evaluate(principal *jwt.Principal, attributes map[string]string) (string, bool) {
+	value, ok := attributes[c.Attribute]
+	if !ok {
+		return fmt.Sprintf("attribute %s missing", c.Attribute), false
+	}
+
+	switch {
+	case c.EqualsClaim != "":
+		claim, ok := principal.Claims[c.EqualsClaim]
+		if !ok || fmt.Sprint(claim) != value {
+			return fmt.Sprintf("attribute %s %q does not equal the claim %s", c.Attribute, value, c.EqualsClaim), false
+		}
+	case len(c.In) > 0:
+		if !contains(c.In, value) {
+			return fmt.Sprintf("attribute %s %q is not one of %v", c.Attribute, value, c.In), false
+		}
+	default:
+		if value != c.Equals {
+			return fmt.Sprintf("attribute %s %q does not equal %q", c.Attribute, value, c.Equals), false
+		}
+	}
+
+	return "", true
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package policy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"go-source/pkg/jwt"
+	logger "go-source/pkg/log"
+	"go-source/pkg/middlewares"
+	"go-source/pkg/utils"
+)
+
+const testPolicies = `
+defaultEffect: deny
+policies:
+  - name: health
+    routes: ["/health"]
+    anonymous: true
+  - name: users-read
+    routes: ["GET /v1/users/:id", "/user.UserService/GetUser"]
+    roles: [admin, support]
+    scopes: [users:read]
+    iasTypes: [CLIENT, SERVICE]
+  - name: users-own-profile
+    routes: ["PUT /v1/users/:id"]
+    conditions:
+      - attribute: param.id
+        equalsClaim: sub
+      - attribute: header.x-client-region
+        in: [VN, TH]
+`
+
+func TestLoadRejectsInvalidPolicies(t *testing.T) {
+	for _, data := range []string{
+		"defaultEffect: maybe",
+		"policies: [{name: p, routes: [/a], iasTypes: [ROBOT]}]",
+		"policies: [{name: p, routes: [/a], conditions: [{attribute: method}]}]",
+		"policies: [{name: p}]",
+	} {
+		if _, err := Load([]byte(data)); !errors.Is(err, ErrInvalidPolicy) {
+			t.Errorf("Load(%q) err = %v, want ErrInvalidPolicy", data, err)
+		}
+	}
+}
+
+func TestEngineEcho(t *testing.T) {
+	logger.InitLog("policy-test")
+
+	engine, err := Load([]byte(testPolicies), WithExplain(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	var principal *jwt.Principal
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if principal != nil {
+				c.SetRequest(c.Request().WithContext(jwt.ContextWithPrincipal(c.Request().Context(), principal)))
+			}
+			return next(c)
+		}
+	})
+	e.Use(engine.Middleware())
+
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/health", ok)
+	e.GET("/v1/users/:id", ok)
+	e.PUT("/v1/users/:id", ok)
+	e.GET("/v1/undeclared", ok)
+	if err = engine.DeclareRoute(e.DELETE("/v1/users/:id", ok), Rule{Roles: []string{"admin"}, IASTypes: []string{utils.IASTypeInternal}}); err != nil {
+		t.Fatal(err)
+	}
+
+	support := &jwt.Principal{
+		Type:   utils.IASTypeClient,
+		Roles:  []string{"support"},
+		Scopes: jwt.Scopes{"users:read"},
+		Claims: map[string]interface{}{"sub": "42"},
+	}
+	admin := &jwt.Principal{
+		Type:   utils.IASTypeInternal,
+		Roles:  []string{"admin"},
+		Claims: map[string]interface{}{"sub": "1"},
+	}
+
+	tests := []struct {
+		name       string
+		principal  *jwt.Principal
+		method     string
+		path       string
+		header     map[string]string
+		wantStatus int
+	}{
+		{name: "anonymous route", method: http.MethodGet, path: "/health", wantStatus: http.StatusOK},
+		{name: "no principal", method: http.MethodGet, path: "/v1/users/1", wantStatus: http.StatusUnauthorized},
+		{name: "role, scope and ias type", principal: support, method: http.MethodGet, path: "/v1/users/1", wantStatus: http.StatusOK},
+		{name: "missing scope", principal: admin, method: http.MethodGet, path: "/v1/users/1", wantStatus: http.StatusForbidden},
+		{name: "undeclared route", principal: admin, method: http.MethodGet, path: "/v1/undeclared", wantStatus: http.StatusForbidden},
+		{name: "declared route", principal: admin, method: http.MethodDelete, path: "/v1/users/1", wantStatus: http.StatusOK},
+		{name: "declared route, other ias type", principal: support, method: http.MethodDelete, path: "/v1/users/1", wantStatus: http.StatusForbidden},
+		{
+			name: "own profile", principal: support, method: http.MethodPut, path: "/v1/users/42",
+			header: map[string]string{"X-Client-Region": "VN"}, wantStatus: http.StatusOK,
+		},
+		{
+			name: "other profile", principal: support, method: http.MethodPut, path: "/v1/users/43",
+			header: map[string]string{"X-Client-Region": "VN"}, wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "own profile, other region", principal: support, method: http.MethodPut, path: "/v1/users/42",
+			header: map[string]string{"X-Client-Region": "US"}, wantStatus: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal = tt.principal
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestEngineGRPC(t *testing.T) {
+	logger.InitLog("policy-test")
+
+	engine, err := Load([]byte(testPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	interceptor := engine.UnaryInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return nil, nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.UserService/GetUser"}
+
+	service := &jwt.Principal{Type: utils.IASTypeService, Roles: []string{"admin"}, Scopes: jwt.Scopes{"users:read"}}
+	if _, err = interceptor(jwt.ContextWithPrincipal(context.Background(), service), nil, info, handler); err != nil {
+		t.Fatalf("interceptor() err = %v", err)
+	}
+
+	public := &jwt.Principal{Type: utils.IASTypePublic, Roles: []string{"admin"}, Scopes: jwt.Scopes{"users:read"}}
+	if _, err = interceptor(jwt.ContextWithPrincipal(context.Background(), public), nil, info, handler); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("interceptor(public) err = %v, want PermissionDenied", err)
+	}
+
+	if _, err = interceptor(context.Background(), nil, info, handler); status.Code(err) != codes.Unauthenticated {
+		t.Fatalf("interceptor(anonymous) err = %v, want Unauthenticated", err)
+	}
+}
+
+func TestEngineAnonymousRoutesBehindAuthentication(t *testing.T) {
+	logger.InitLog("policy-test")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := jwt.JwtConfig{
+		Alg:        jwt.ES256,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		Expire:     time.Minute,
+	}
+	j, err := jwt.NewJWT(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := jwt.NewIssuer(j, cfg)
+
+	engine, err := Load([]byte(testPolicies))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := echo.New()
+	e.Use(middlewares.Authentication(issuer.Verifier(), nil, middlewares.WithOptionalToken()), engine.Middleware())
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	e.GET("/health", ok)
+	e.GET("/v1/users/:id", ok)
+
+	token, err := issuer.Issue(map[string]interface{}{
+		"sub": "42", "type": utils.IASTypeClient, "roles": []string{"support"}, "scope": "users:read",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "anonymous route without token", path: "/health", wantStatus: http.StatusOK},
+		{name: "protected route without token", path: "/v1/users/42", wantStatus: http.StatusUnauthorized},
+		{name: "protected route with token", path: "/v1/users/42", token: token, wantStatus: http.StatusOK},
+		{name: "invalid token", path: "/health", token: "invalid", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package kafka
+
+import (
+	"context"
+	logger "go-source/pkg/log"
+	"go-source/pkg/utils"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// batchRetryBackoff is how long the partitions of a failed batch are paused before it is read again.
+const batchRetryBackoff = time.Second
+
+// Message is a consumed message handed to batch handlers. Ctx carries the trace info
+// restored from the message headers.
+type Message struct {
+	Ctx       context.Context
+	Topic     string
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+	Headers   []kafka.Header
+	Timestamp time.Time
+
+	raw *kafka.Message
+}
+
+type OnBatchHandler func(ctx context.Context, messages []Message) error
+
+type batchState struct {
+	handler  OnBatchHandler
+	maxSize  int
+	maxWait  time.Duration
+	messages []Message
+	deadline time.Time
+}
+
+// OnBatch switches the consumer to batch mode, replacing OnEvent and the worker pool. Messages
+// are collected until maxSize messages arrived or maxWait passed since the first one, then
+// handler is called once. The highest offsets of the batch are committed only when it succeeds;
+// otherwise the batch goes through the retry policy, or is read again when there is none.
+func (s *Consumer) OnBatch(handler OnBatchHandler, maxSize int, maxWait time.Duration) {
+	if handler == nil {
+		return
+	}
+	if maxSize <= 0 {
+		maxSize = 1
+	}
+
+	s.mu.Lock()
+	s.batch = &batchState{
+		handler:  handler,
+		maxSize:  maxSize,
+		maxWait:  maxWait,
+		messages: make([]Message, 0, maxSize),
+	}
+	s.pool = nil
+	s.mu.Unlock()
+}
+
+// readTimeout returns how long the consumer may wait for the next message before the batch is due.
+func (b *batchState) readTimeout() time.Duration {
+	if len(b.messages) == 0 {
+		return readTimeout
+	}
+
+	remaining := time.Until(b.deadline)
+	if remaining > readTimeout {
+		return readTimeout
+	}
+	return remaining
+}
+
+func (s *Consumer) addToBatch(ctx context.Context, msg *kafka.Message) {
+	if len(s.batch.messages) == 0 {
+		s.batch.deadline = time.Now().Add(s.batch.maxWait)
+	}
+
+	s.batch.messages = append(s.batch.messages, Message{
+		Ctx:       messageContext(ctx, msg),
+		Topic:     *msg.TopicPartition.Topic,
+		Partition: msg.TopicPartition.Partition,
+		Offset:    int64(msg.TopicPartition.Offset),
+		Key:       msg.Key,
+		Value:     msg.Value,
+		Headers:   msg.Headers,
+		Timestamp: msg.Timestamp,
+		raw:       msg,
+	})
+
+	if len(s.batch.messages) >= s.batch.maxSize {
+		s.flushBatch(ctx)
+	}
+}
+
+// flushBatch hands the collected messages to the batch handler.
+func (s *Consumer) flushBatch(ctx context.Context) {
+	messages := s.batch.messages
+	if len(messages) == 0 {
+		return
+	}
+	s.batch.messages = make([]Message, 0, s.batch.maxSize)
+
+	// the batch is also flushed on shutdown, so the handler must not inherit the consumer's cancellation
+	newCtx, _ := utils.NewContextWithRequestId(utils.NewContextBackgroundFromCtx(ctx))
+	log := logger.GetLogger().AddTraceInfoContextRequest(newCtx)
+	log.Info().Int("size", len(messages)).Msg("kafka handle batch")
+
+	err := s.batch.handler(newCtx, messages)
+	if err != nil {
+		log.Err(err).Int("size", len(messages)).Msg("kafka batch handlers failed")
+		if !s.onBatchError(newCtx, messages, err) {
+			return
+		}
+	}
+
+	for _, m := range messages {
+		s.markOffset(m.raw.TopicPartition)
+	}
+
+	if err := s.commitPending(nil); err != nil {
+		log.Err(err).Msg("kafka commit failed")
+	}
+}
+
+// onBatchError republishes every message of a failed batch through the retry policy. Without
+// a policy, or when republishing fails, each partition is rewound to its first message in the
+// batch. It reports whether the batch may be committed.
+func (s *Consumer) onBatchError(ctx context.Context, messages []Message, err error) bool {
+	if s.retryPolicy != nil && s.republishBatch(ctx, messages, err) {
+		return true
+	}
+
+	first := make(map[partitionKey]kafka.TopicPartition)
+	for _, m := range messages {
+		key := partitionKey{topic: m.Topic, partition: m.Partition}
+		if tp, ok := first[key]; !ok || m.raw.TopicPartition.Offset < tp.Offset {
+			first[key] = m.raw.TopicPartition
+		}
+	}
+
+	for _, tp := range first {
+		s.pauseUntil(tp, time.Now().Add(batchRetryBackoff))
+	}
+
+	return false
+}
+
+// republishBatch republishes the messages of a failed batch together and reports whether all
+// of them were delivered.
+func (s *Consumer) republishBatch(ctx context.Context, messages []Message, handlerErr error) bool {
+	log := logger.GetLogger().AddTraceInfoContextRequest(ctx)
+
+	retries := make([]*kafka.Message, 0, len(messages))
+	for _, m := range messages {
+		retry, _, err := s.retryMessage(m.Ctx, m.raw, handlerErr)
+		if err != nil {
+			log.Err(err).Str("topic", m.Topic).Msg("kafka build retry message failed")
+			return false
+		}
+		retries = append(retries, retry)
+	}
+
+	if err := s.republish(ctx, retries...); err != nil {
+		log.Err(err).Int("size", len(messages)).Msg("kafka republish failed batch failed")
+		return false
+	}
+
+	log.Warn().Err(handlerErr).Int("size", len(messages)).Msg("kafka batch sent to retry")
+	return true
+}
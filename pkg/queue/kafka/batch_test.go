@@ -0,0 +1,40 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBatchState_ReadTimeout(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages int
+		deadline time.Duration
+		want     func(time.Duration) bool
+	}{
+		{
+			name: "empty batch",
+			want: func(d time.Duration) bool { return d == readTimeout },
+		},
+		{
+			name: "deadline after the read timeout", messages: 1, deadline: time.Minute,
+			want: func(d time.Duration) bool { return d == readTimeout },
+		},
+		{
+			name: "deadline before the read timeout", messages: 1, deadline: 100 * time.Millisecond,
+			want: func(d time.Duration) bool { return d > 0 && d <= 100*time.Millisecond },
+		},
+		{
+			name: "deadline passed", messages: 1, deadline: -time.Second,
+			want: func(d time.Duration) bool { return d <= 0 },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &batchState{messages: make([]Message, tt.messages), deadline: time.Now().Add(tt.deadline)}
+			if got := b.readTimeout(); !tt.want(got) {
+				t.Fatalf("readTimeout() = %v", got)
+			}
+		})
+	}
+}
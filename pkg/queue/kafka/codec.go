@@ -0,0 +1,147 @@
+package kafka
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/linkedin/goavro/v2"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrSchemaRequired  = errors.New("codec requires a schema")
+	ErrNotProtoMessage = errors.New("value is not a proto.Message")
+)
+
+// Codec turns values into message payloads and back. Schema is nil when the serializer has
+// no registry; codecs that cannot work without one return ErrSchemaRequired.
+type Codec interface {
+	Type() SchemaType
+	Marshal(schema *Schema, v interface{}) ([]byte, error)
+	Unmarshal(schema *Schema, data []byte, v interface{}) error
+}
+
+type JSONCodec struct{}
+
+func (JSONCodec) Type() SchemaType {
+	return SchemaTypeJSON
+}
+
+func (JSONCodec) Marshal(_ *Schema, v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(_ *Schema, data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// ProtobufCodec encodes generated protobuf types such as the ones in api/grpc/proto/gen.
+type ProtobufCodec struct{}
+
+func (ProtobufCodec) Type() SchemaType {
+	return SchemaTypeProtobuf
+}
+
+func (ProtobufCodec) Marshal(_ *Schema, v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrNotProtoMessage, v)
+	}
+	return proto.Marshal(msg)
+}
+
+// Unmarshal accepts a proto.Message or a pointer to one, which is allocated when nil.
+func (ProtobufCodec) Unmarshal(_ *Schema, data []byte, v interface{}) error {
+	if msg, ok := v.(proto.Message); ok {
+		return proto.Unmarshal(data, msg)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Ptr {
+		return fmt.Errorf("%w: %T", ErrNotProtoMessage, v)
+	}
+
+	if rv.Elem().IsNil() {
+		rv.Elem().Set(reflect.New(rv.Elem().Type().Elem()))
+	}
+
+	msg, ok := rv.Elem().Interface().(proto.Message)
+	if !ok {
+		return fmt.Errorf("%w: %T", ErrNotProtoMessage, v)
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// AvroCodec encodes values with the Avro schema resolved by the serializer. Values are mapped
+// through their JSON form, so field names follow the json tags; unions must be written in the
+// Avro JSON form ({"type": value}).
+type AvroCodec struct {
+	codecs sync.Map // definition -> *goavro.Codec
+}
+
+func NewAvroCodec() *AvroCodec {
+	return &AvroCodec{}
+}
+
+func (c *AvroCodec) Type() SchemaType {
+	return SchemaTypeAvro
+}
+
+func (c *AvroCodec) Marshal(schema *Schema, v interface{}) ([]byte, error) {
+	codec, err := c.codec(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	native, _, err := codec.NativeFromTextual(data)
+	if err != nil {
+		return nil, fmt.Errorf("avro native from json: %w", err)
+	}
+
+	return codec.BinaryFromNative(nil, native)
+}
+
+func (c *AvroCodec) Unmarshal(schema *Schema, data []byte, v interface{}) error {
+	codec, err := c.codec(schema)
+	if err != nil {
+		return err
+	}
+
+	native, _, err := codec.NativeFromBinary(data)
+	if err != nil {
+		return fmt.Errorf("avro native from binary: %w", err)
+	}
+
+	textual, err := codec.TextualFromNative(nil, native)
+	if err != nil {
+		return fmt.Errorf("avro json from native: %w", err)
+	}
+
+	return json.Unmarshal(textual, v)
+}
+
+func (c *AvroCodec) codec(schema *Schema) (*goavro.Codec, error) {
+	if schema == nil || schema.Definition == "" {
+		return nil, ErrSchemaRequired
+	}
+
+	if codec, ok := c.codecs.Load(schema.Definition); ok {
+		return codec.(*goavro.Codec), nil
+	}
+
+	codec, err := goavro.NewCodec(schema.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("avro schema %d: %w", schema.ID, err)
+	}
+
+	c.codecs.Store(schema.Definition, codec)
+	return codec, nil
+}
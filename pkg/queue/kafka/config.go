@@ -9,4 +9,8 @@ type KafkaConfig struct {
 	SaslMechanisms   string `env:"SASL_MECHANISMS"`
 	SaslUsername     string `env:"SASL_USERNAME"`
 	SaslPassword     string `env:"SASL_PASSWORD"`
+
+	// WorkerLanes enables the consumer worker pool when greater than zero.
+	WorkerLanes      int `env:"WORKER_LANES"`
+	WorkerLaneBuffer int `env:"WORKER_LANE_BUFFER"`
 }
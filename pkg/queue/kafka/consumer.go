@@ -2,12 +2,11 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 	logger "go-source/pkg/log"
-	"go-source/pkg/utils"
+	"go-source/pkg/metric"
 	"sync"
 	"time"
 )
@@ -15,10 +14,22 @@ import (
 var (
 	ErrAlreadyStarted  = errors.New("already started")
 	ErrNilEventHandler = errors.New("event handlers is nil")
+	// ErrConsumerClosed is returned by Start once Shutdown closed the consumer.
+	ErrConsumerClosed = errors.New("kafka consumer closed")
+)
+
+const (
+	readTimeout   = 500 * time.Millisecond
+	seekTimeoutMs = 5000
+	queryTimeout  = 10 * time.Second
 )
 
 type OnEventHandler func(ctx context.Context, key, value []byte) error
 
+// RebalanceHandler is called from the consumer loop when partitions are assigned or revoked.
+// On assignment it runs after the partitions are assigned, so it may call Seek.
+type RebalanceHandler func(ctx context.Context, partitions []kafka.TopicPartition)
+
 type ConsumerInterface interface {
 	OnEvent(handler OnEventHandler)
 	Start(ctx context.Context) error
@@ -26,21 +37,79 @@ type ConsumerInterface interface {
 }
 
 type Consumer struct {
-	cs      *kafka.Consumer
-	topics  []string
-	handler OnEventHandler
+	cs         *kafka.Consumer
+	topics     []string
+	handler    OnEventHandler
+	onAssigned RebalanceHandler
+	onRevoked  RebalanceHandler
 
-	started bool
-	mu      sync.RWMutex
+	retryPolicy   *RetryPolicy
+	retryProducer *Producer
+	// paused holds partitions waiting for a retry delay, owned by the consumer loop.
+	paused map[partitionKey]pausedPartition
+	// revoking holds the partitions being revoked while the rebalance callback runs.
+	revoking map[partitionKey]struct{}
+	pool     *workerPool
+	batch    *batchState
+
+	// pending holds the next offset to commit for each partition whose messages
+	// were handled but not committed yet.
+	pending  map[partitionKey]kafka.TopicPartition
+	offsetMu sync.Mutex
+
+	started   bool
+	closed    bool
+	stopCh    chan struct{}
+	doneCh    chan struct{}
+	stopOnce  sync.Once
+	closeOnce sync.Once
+	mu        sync.RWMutex
+}
+
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+type pausedPartition struct {
+	tp       kafka.TopicPartition
+	resumeAt time.Time
 }
 
 func NewConsumer(cfg KafkaConfig, topics []string) *Consumer {
 	log := logger.GetLogger()
 
+	cfgMap := newConsumerConfigMap(cfg)
+	cs, err := kafka.NewConsumer(&cfgMap)
+
+	if err != nil {
+		log.Fatal().Err(err).Msg("init kafka consumer failed")
+	}
+
+	log.Info().Msgf("init kafka consumer success : TOPIC = %v", topics)
+	res := &Consumer{
+		cs:      cs,
+		topics:  topics,
+		pending: make(map[partitionKey]kafka.TopicPartition),
+		paused:  make(map[partitionKey]pausedPartition),
+		stopCh:  make(chan struct{}),
+		doneCh:  make(chan struct{}),
+	}
+
+	res.SetWorkerPool(WorkerPoolConfig{
+		Lanes:      cfg.WorkerLanes,
+		LaneBuffer: cfg.WorkerLaneBuffer,
+	})
+
+	return res
+}
+
+func newConsumerConfigMap(cfg KafkaConfig) kafka.ConfigMap {
 	cfgMap := kafka.ConfigMap{
-		"bootstrap.servers": cfg.BootstrapServers,
-		"group.id":          cfg.GroupID,
-		"auto.offset.reset": cfg.AutoOffsetReset,
+		"bootstrap.servers":  cfg.BootstrapServers,
+		"group.id":           cfg.GroupID,
+		"auto.offset.reset":  cfg.AutoOffsetReset,
+		"enable.auto.commit": false,
 	}
 
 	if cfg.SecurityProtocol != "" {
@@ -61,17 +130,7 @@ func NewConsumer(cfg KafkaConfig, topics []string) *Consumer {
 		cfgMap["sasl.password"] = cfg.SaslPassword
 	}
 
-	cs, err := kafka.NewConsumer(&cfgMap)
-
-	if err != nil {
-		log.Fatal().Err(err).Msg("init kafka consumer failed")
-	}
-
-	log.Info().Msgf("init kafka consumer success : TOPIC = %v", topics)
-	return &Consumer{
-		cs:     cs,
-		topics: topics,
-	}
+	return cfgMap
 }
 
 func (s *Consumer) OnEvent(handler OnEventHandler) {
@@ -82,78 +141,413 @@ func (s *Consumer) OnEvent(handler OnEventHandler) {
 	s.mu.Unlock()
 }
 
+// OnPartitionsAssigned registers a callback for partition assignment. It must be set before Start.
+func (s *Consumer) OnPartitionsAssigned(handler RebalanceHandler) {
+	s.mu.Lock()
+	s.onAssigned = handler
+	s.mu.Unlock()
+}
+
+// OnPartitionsRevoked registers a callback for partition revocation. Offsets of handled
+// messages on the revoked partitions are committed before it runs. It must be set before Start.
+func (s *Consumer) OnPartitionsRevoked(handler RebalanceHandler) {
+	s.mu.Lock()
+	s.onRevoked = handler
+	s.mu.Unlock()
+}
+
+// Start consumes messages until ctx is cancelled or Shutdown is called. The message being
+// handled is finished, final offsets are committed and the underlying consumer is closed
+// before Start returns.
 func (s *Consumer) Start(ctx context.Context) error {
 	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrConsumerClosed
+	}
 	if s.started {
 		s.mu.Unlock()
 		return ErrAlreadyStarted
 	}
-	if s.handler == nil {
+	if s.handler == nil && s.batch == nil {
 		s.mu.Unlock()
 		return ErrNilEventHandler
 	}
+	if s.retryPolicy != nil && s.retryProducer == nil {
+		s.mu.Unlock()
+		return ErrNilRetryProducer
+	}
 	s.started = true
 	s.mu.Unlock()
 
-	if err := s.cs.SubscribeTopics(s.topics, nil); err != nil {
+	defer close(s.doneCh)
+	defer s.close()
+
+	if s.batch != nil {
+		defer s.flushBatch(ctx)
+	} else if s.pool != nil {
+		s.startWorkers(ctx)
+		defer s.stopWorkers()
+	}
+
+	topics := s.topics
+	if s.retryPolicy != nil {
+		topics = append(append([]string{}, s.topics...), s.retryPolicy.topics(s.topics)...)
+	}
+
+	if err := s.cs.SubscribeTopics(topics, s.rebalance(ctx)); err != nil {
 		return fmt.Errorf("subscribe: %w", err)
 	}
 
 	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.stopCh:
+			return nil
+		default:
+		}
+
+		s.resumeDue()
+		if s.pool != nil {
+			s.collect()
+		}
+
+		timeout := readTimeout
+		if s.batch != nil {
+			if timeout = s.batch.readTimeout(); timeout <= 0 {
+				s.flushBatch(ctx)
+				continue
+			}
+		}
+
 		log := logger.GetLogger()
-		msg, err := s.cs.ReadMessage(10 * time.Second)
+		msg, err := s.cs.ReadMessage(timeout)
 		if err != nil {
 			var kerr kafka.Error
-			if errors.As(err, &kerr); kerr.Code() == kafka.ErrTimedOut {
+			if errors.As(err, &kerr) && kerr.Code() == kafka.ErrTimedOut {
 				continue
 			}
 			log.Warn().Err(err).Msg("kafka read message failed")
 			continue
 		}
 
-		traceInfoExisted := false
-		newCtx := context.Background()
-
-		for _, h := range msg.Headers {
-			if h.Key == utils.KeyTraceInfo {
-				traceInfo := utils.TraceInfo{}
-				if err = json.Unmarshal(h.Value, &traceInfo); err != nil {
-					break
-				}
-				newCtx = context.WithValue(newCtx, utils.KeyTraceInfo, traceInfo)
-				traceInfoExisted = true
+		s.recordLag(msg.TopicPartition)
+
+		if s.retryPolicy != nil {
+			if at := notBefore(msg); time.Now().Before(at) {
+				s.pauseUntil(msg.TopicPartition, at)
+				continue
 			}
 		}
 
-		if !traceInfoExisted {
-			newCtx, _ = utils.NewContextWithRequestId(ctx)
+		switch {
+		case s.batch != nil:
+			s.addToBatch(ctx, msg)
+		case s.pool != nil:
+			s.dispatch(msg)
+		default:
+			s.handleMessage(ctx, msg)
 		}
+	}
+}
 
-		log = log.AddTraceInfoContextRequest(newCtx)
-		log.Info().
-			Interface("topicPartition", msg.TopicPartition).
-			Str("value", string(msg.Value)).
-			Str("key", string(msg.Key)).
-			Time("timestamp", msg.Timestamp).
-			Int("timestampType", int(msg.TimestampType)).
-			Interface("opaque", msg.Opaque).
-			Interface("headers", msg.Headers).
-			Msg("kafka read message success")
-
-		if err = s.handler(newCtx, msg.Key, msg.Value); err != nil {
-			log.Err(err).Msg("kafka handlers failed")
-			continue
-		}
+func (s *Consumer) recordLag(tp kafka.TopicPartition) {
+	_, high, err := s.cs.GetWatermarkOffsets(*tp.Topic, tp.Partition)
+	if err != nil || high < 0 {
+		return
+	}
+	metric.RecordKafkaConsumerLag(*tp.Topic, tp.Partition, high-int64(tp.Offset)-1)
+}
 
-		if _, err = s.cs.CommitMessage(msg); err != nil {
-			log.Err(err).Msg("kafka commit failed")
-		}
+func (s *Consumer) handleMessage(ctx context.Context, msg *kafka.Message) {
+	newCtx, err := s.process(ctx, msg)
+	if err != nil && !s.onHandlerError(newCtx, msg, err) {
+		return
 	}
+
+	s.markOffset(msg.TopicPartition)
+	if err := s.commitPending(nil); err != nil {
+		logger.GetLogger().AddTraceInfoContextRequest(newCtx).Err(err).Msg("kafka commit failed")
+	}
+}
+
+// process restores the trace info of msg and runs the handler.
+func (s *Consumer) process(ctx context.Context, msg *kafka.Message) (context.Context, error) {
+	newCtx := messageContext(ctx, msg)
+
+	log := logger.GetLogger().AddTraceInfoContextRequest(newCtx)
+	log.Info().
+		Interface("topicPartition", msg.TopicPartition).
+		Str("value", string(msg.Value)).
+		Str("key", string(msg.Key)).
+		Time("timestamp", msg.Timestamp).
+		Int("timestampType", int(msg.TimestampType)).
+		Interface("opaque", msg.Opaque).
+		Interface("headers", msg.Headers).
+		Msg("kafka read message success")
+
+	return newCtx, s.handler(newCtx, msg.Key, msg.Value)
+}
+
+// messageContext returns a context carrying the trace info and trace context of msg, or
+// new ones when msg has none.
+func messageContext(ctx context.Context, msg *kafka.Message) context.Context {
+	newCtx := extractTraceHeaders(ctx, msg)
+
+	if msg.TopicPartition.Topic != nil {
+		newCtx = context.WithValue(newCtx, KeyMessageTopic, *msg.TopicPartition.Topic)
+		newCtx = context.WithValue(newCtx, KeyMessage, Message{
+			Topic:     *msg.TopicPartition.Topic,
+			Partition: msg.TopicPartition.Partition,
+			Offset:    int64(msg.TopicPartition.Offset),
+			Key:       msg.Key,
+			Value:     msg.Value,
+			Headers:   msg.Headers,
+			Timestamp: msg.Timestamp,
+		})
+	}
+
+	return newCtx
 }
 
+// MessageFromContext returns the consumed message of a handler context, without its Ctx.
+func MessageFromContext(ctx context.Context) (Message, bool) {
+	msg, ok := ctx.Value(KeyMessage).(Message)
+	return msg, ok
+}
+
+// onHandlerError reports whether a message whose handler failed may be committed.
+func (s *Consumer) onHandlerError(ctx context.Context, msg *kafka.Message, err error) bool {
+	logger.GetLogger().AddTraceInfoContextRequest(ctx).Err(err).Msg("kafka handlers failed")
+	return s.retryPolicy != nil && s.handleFailure(ctx, msg, err)
+}
+
+// Shutdown stops Start and waits until it has committed offsets and closed the consumer,
+// or until ctx is done.
 func (s *Consumer) Shutdown(ctx context.Context) {
+	log := logger.GetLogger()
+
+	s.stopOnce.Do(func() {
+		close(s.stopCh)
+	})
+
+	// a consumer shut down before Start is closed here, and never started afterwards
+	s.mu.Lock()
+	started := s.started
+	if !started {
+		s.closed = true
+	}
+	s.mu.Unlock()
+
+	if !started {
+		s.close()
+		return
+	}
+
+	select {
+	case <-s.doneCh:
+		log.Info().Msgf("kafka consumer stopped : TOPIC = %v", s.topics)
+	case <-ctx.Done():
+		log.Warn().Err(ctx.Err()).Msgf("kafka consumer shutdown timed out : TOPIC = %v", s.topics)
+	}
+}
+
+// Seek moves the consume position of an assigned partition to offset.
+func (s *Consumer) Seek(topic string, partition int32, offset kafka.Offset) error {
+	tp := kafka.TopicPartition{
+		Topic:     &topic,
+		Partition: partition,
+		Offset:    offset,
+	}
+
+	s.dropPending(topic, partition)
+	if s.pool != nil {
+		s.forgetOffsets([]kafka.TopicPartition{tp})
+	}
+
+	return s.cs.Seek(tp, seekTimeoutMs)
+}
+
+// SeekToTimestamp moves every assigned partition to the first message at or after ts.
+// Partitions without such a message are moved to their end.
+func (s *Consumer) SeekToTimestamp(ts time.Time) error {
+	assigned, err := s.cs.Assignment()
+	if err != nil {
+		return fmt.Errorf("assignment: %w", err)
+	}
+
+	if len(assigned) == 0 {
+		return nil
+	}
+
+	times := make([]kafka.TopicPartition, 0, len(assigned))
+	for _, tp := range assigned {
+		times = append(times, kafka.TopicPartition{
+			Topic:     tp.Topic,
+			Partition: tp.Partition,
+			Offset:    kafka.Offset(ts.UnixMilli()),
+		})
+	}
+
+	offsets, err := s.cs.OffsetsForTimes(times, int(queryTimeout.Milliseconds()))
+	if err != nil {
+		return fmt.Errorf("offsets for times: %w", err)
+	}
+
+	for _, tp := range offsets {
+		if tp.Error != nil {
+			return fmt.Errorf("offsets for times %s[%d]: %w", *tp.Topic, tp.Partition, tp.Error)
+		}
+
+		offset := tp.Offset
+		if offset < 0 {
+			offset = kafka.OffsetEnd
+		}
+
+		if err = s.Seek(*tp.Topic, tp.Partition, offset); err != nil {
+			return fmt.Errorf("seek %s[%d]: %w", *tp.Topic, tp.Partition, err)
+		}
+	}
+
+	return nil
 }
 
 func (s *Consumer) GetTopics() []string {
 	return s.topics
 }
+
+func (s *Consumer) rebalance(ctx context.Context) kafka.RebalanceCb {
+	return func(cs *kafka.Consumer, event kafka.Event) error {
+		log := logger.GetLogger()
+		cooperative := cs.GetRebalanceProtocol() == "COOPERATIVE"
+
+		s.mu.RLock()
+		onAssigned, onRevoked := s.onAssigned, s.onRevoked
+		s.mu.RUnlock()
+
+		switch e := event.(type) {
+		case kafka.AssignedPartitions:
+			log.Info().Interface("partitions", e.Partitions).Msg("kafka partitions assigned")
+
+			var err error
+			if cooperative {
+				err = cs.IncrementalAssign(e.Partitions)
+			} else {
+				err = cs.Assign(e.Partitions)
+			}
+			if err != nil {
+				return err
+			}
+
+			if onAssigned != nil {
+				onAssigned(ctx, e.Partitions)
+			}
+
+		case kafka.RevokedPartitions:
+			log.Info().Interface("partitions", e.Partitions).Msg("kafka partitions revoked")
+			s.forgetPaused(e.Partitions)
+
+			// messages still handled below must not pause the partitions this consumer is losing
+			s.revoking = make(map[partitionKey]struct{}, len(e.Partitions))
+			for _, p := range e.Partitions {
+				s.revoking[partitionKey{topic: *p.Topic, partition: p.Partition}] = struct{}{}
+			}
+			defer func() { s.revoking = nil }()
+
+			if s.batch != nil {
+				s.flushBatch(ctx)
+			} else if s.pool != nil {
+				s.drain()
+				defer s.forgetOffsets(e.Partitions)
+			}
+
+			if cs.AssignmentLost() {
+				s.dropPendingPartitions(e.Partitions)
+			} else if err := s.commitPending(e.Partitions); err != nil {
+				log.Err(err).Msg("kafka commit on revoke failed")
+			}
+
+			if onRevoked != nil {
+				onRevoked(ctx, e.Partitions)
+			}
+
+			if cooperative {
+				return cs.IncrementalUnassign(e.Partitions)
+			}
+			return cs.Unassign()
+		}
+
+		return nil
+	}
+}
+
+func (s *Consumer) markOffset(tp kafka.TopicPartition) {
+	s.offsetMu.Lock()
+	defer s.offsetMu.Unlock()
+
+	s.pending[partitionKey{topic: *tp.Topic, partition: tp.Partition}] = kafka.TopicPartition{
+		Topic:     tp.Topic,
+		Partition: tp.Partition,
+		Offset:    tp.Offset + 1,
+	}
+}
+
+// commitPending commits the pending offsets of partitions, or of every partition when partitions is nil.
+func (s *Consumer) commitPending(partitions []kafka.TopicPartition) error {
+	s.offsetMu.Lock()
+	defer s.offsetMu.Unlock()
+
+	var offsets []kafka.TopicPartition
+	if partitions == nil {
+		for _, tp := range s.pending {
+			offsets = append(offsets, tp)
+		}
+	} else {
+		for _, p := range partitions {
+			if tp, ok := s.pending[partitionKey{topic: *p.Topic, partition: p.Partition}]; ok {
+				offsets = append(offsets, tp)
+			}
+		}
+	}
+
+	if len(offsets) == 0 {
+		return nil
+	}
+
+	if _, err := s.cs.CommitOffsets(offsets); err != nil {
+		return err
+	}
+
+	for _, tp := range offsets {
+		delete(s.pending, partitionKey{topic: *tp.Topic, partition: tp.Partition})
+	}
+
+	return nil
+}
+
+func (s *Consumer) dropPending(topic string, partition int32) {
+	s.offsetMu.Lock()
+	delete(s.pending, partitionKey{topic: topic, partition: partition})
+	s.offsetMu.Unlock()
+}
+
+func (s *Consumer) dropPendingPartitions(partitions []kafka.TopicPartition) {
+	for _, p := range partitions {
+		s.dropPending(*p.Topic, p.Partition)
+	}
+}
+
+func (s *Consumer) close() {
+	s.closeOnce.Do(func() {
+		log := logger.GetLogger()
+
+		if err := s.commitPending(nil); err != nil {
+			log.Err(err).Msg("kafka final commit failed")
+		}
+
+		if err := s.cs.Close(); err != nil {
+			log.Err(err).Msg("kafka consumer close failed")
+		}
+	})
+}
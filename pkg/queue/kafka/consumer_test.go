@@ -0,0 +1,47 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+
+	logger "go-source/pkg/log"
+)
+
+func TestConsumer_PendingOffsets(t *testing.T) {
+	s := &Consumer{pending: make(map[partitionKey]kafka.TopicPartition)}
+	orders, payments := "orders", "payments"
+
+	s.markOffset(kafka.TopicPartition{Topic: &orders, Partition: 0, Offset: 7})
+	s.markOffset(kafka.TopicPartition{Topic: &orders, Partition: 0, Offset: 9})
+	s.markOffset(kafka.TopicPartition{Topic: &orders, Partition: 1, Offset: 3})
+	s.markOffset(kafka.TopicPartition{Topic: &payments, Partition: 0, Offset: 0})
+
+	// the committed offset is the next one to read
+	if got := s.pending[partitionKey{topic: orders, partition: 0}].Offset; got != 10 {
+		t.Fatalf("pending offset = %d, want 10", got)
+	}
+
+	s.dropPendingPartitions([]kafka.TopicPartition{{Topic: &orders, Partition: 0}, {Topic: &payments, Partition: 0}})
+	if len(s.pending) != 1 {
+		t.Fatalf("pending = %v, want orders[1] only", s.pending)
+	}
+	if got := s.pending[partitionKey{topic: orders, partition: 1}].Offset; got != 4 {
+		t.Fatalf("pending offset = %d, want 4", got)
+	}
+}
+
+func TestConsumer_StartAfterShutdown(t *testing.T) {
+	logger.InitLog("kafka-test")
+
+	// the consumer connects on Start only, no broker is needed
+	s := NewConsumer(KafkaConfig{BootstrapServers: "localhost:9092", GroupID: "orders-test", AutoOffsetReset: "earliest"}, []string{"orders"})
+	s.OnEvent(func(ctx context.Context, key, value []byte) error { return nil })
+
+	s.Shutdown(context.Background())
+	if err := s.Start(context.Background()); !errors.Is(err, ErrConsumerClosed) {
+		t.Fatalf("Start() err = %v, want ErrConsumerClosed", err)
+	}
+}
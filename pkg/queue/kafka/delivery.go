@@ -0,0 +1,131 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	logger "go-source/pkg/log"
+	"go-source/pkg/metric"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+const flushInterval = 100 * time.Millisecond
+
+var ErrProducerFlush = errors.New("kafka producer flush incomplete")
+
+// deliveryWaiter is set as the message Opaque by PublishSync to receive its delivery report.
+type deliveryWaiter chan error
+
+// handleDeliveryReports drains the producer events until the producer is closed.
+func (s *Producer) handleDeliveryReports() {
+	defer close(s.reportsDone)
+
+	for ev := range s.pr.Events() {
+		switch e := ev.(type) {
+		case *kafka.Message:
+			s.onDelivery(e)
+		case kafka.Error:
+			logger.GetLogger().Err(e).Msgf("kafka producer error : TOPIC = %v", s.topic)
+		}
+	}
+}
+
+func (s *Producer) onDelivery(msg *kafka.Message) {
+	topic := s.topic
+	if msg.TopicPartition.Topic != nil {
+		topic = *msg.TopicPartition.Topic
+	}
+
+	err := msg.TopicPartition.Error
+	if err != nil {
+		metric.RecordKafkaProducerDelivery(topic, metric.DefaultErr.Error())
+
+		log := logger.GetLogger().AddTraceInfoContextRequest(messageContext(context.Background(), msg))
+		log.Err(err).
+			Str("topic", topic).
+			Str("key", string(msg.Key)).
+			Msg("kafka delivery failed")
+	} else {
+		metric.RecordKafkaProducerDelivery(topic, "SUCCESS")
+	}
+
+	if waiter, ok := msg.Opaque.(deliveryWaiter); ok {
+		waiter <- err
+	}
+}
+
+// PublishSync publishes like Publish and waits for the broker ack or for ctx to be done.
+func (s *Producer) PublishSync(ctx context.Context, key, value interface{}) error {
+	msg, err := s.newMessage(ctx, s.topic, kafka.PartitionAny, key, value)
+	if err != nil {
+		return err
+	}
+	return s.produceSync(ctx, msg)
+}
+
+// PublishMessageSync publishes like PublishMessage and waits for the broker ack or for ctx
+// to be done.
+func (s *Producer) PublishMessageSync(ctx context.Context, msg *kafka.Message) error {
+	if err := injectTraceHeaders(ctx, msg); err != nil {
+		return err
+	}
+	return s.produceSync(ctx, msg)
+}
+
+// produceSync produces every message and waits for all their delivery reports. It returns
+// the first delivery error.
+func (s *Producer) produceSync(ctx context.Context, msgs ...*kafka.Message) error {
+	waiters := make([]deliveryWaiter, 0, len(msgs))
+	for _, msg := range msgs {
+		waiter := make(deliveryWaiter, 1)
+		msg.Opaque = waiter
+
+		if err := s.pr.Produce(msg, nil); err != nil {
+			return err
+		}
+		waiters = append(waiters, waiter)
+	}
+
+	for _, waiter := range waiters {
+		select {
+		case err := <-waiter:
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return fmt.Errorf("wait delivery report: %w", ctx.Err())
+		}
+	}
+
+	return nil
+}
+
+// Flush waits until every outstanding message is delivered or ctx is done.
+func (s *Producer) Flush(ctx context.Context) error {
+	for {
+		remaining := s.pr.Flush(int(flushInterval.Milliseconds()))
+		if remaining == 0 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %d messages remaining: %w", ErrProducerFlush, remaining, ctx.Err())
+		default:
+		}
+	}
+}
+
+// Close flushes outstanding messages until ctx is done, closes the producer and waits for the
+// remaining delivery reports to be handled.
+func (s *Producer) Close(ctx context.Context) error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.Flush(ctx)
+		s.pr.Close()
+		<-s.reportsDone
+	})
+	return err
+}
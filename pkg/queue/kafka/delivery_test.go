@@ -0,0 +1,48 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+
+	logger "go-source/pkg/log"
+)
+
+func TestProducer_OnDeliveryResolvesWaiter(t *testing.T) {
+	logger.InitLog("kafka-test")
+
+	s := &Producer{topic: "orders"}
+	topic := "orders"
+	deliveryErr := kafka.NewError(kafka.ErrMsgTimedOut, "message timed out", false)
+
+	tests := []struct {
+		name    string
+		err     error
+		wantErr bool
+	}{
+		{name: "delivered"},
+		{name: "failed", err: deliveryErr, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waiter := make(deliveryWaiter, 1)
+			s.onDelivery(&kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &topic, Error: tt.err},
+				Opaque:         waiter,
+			})
+
+			select {
+			case err := <-waiter:
+				if (err != nil) != tt.wantErr || (tt.wantErr && !errors.Is(err, tt.err)) {
+					t.Fatalf("delivery error = %v, want %v", err, tt.err)
+				}
+			default:
+				t.Fatal("waiter not resolved")
+			}
+		})
+	}
+
+	// messages published without waiting are only recorded
+	s.onDelivery(&kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}, Opaque: "other"})
+}
@@ -0,0 +1,113 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	logger "go-source/pkg/log"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// replayIdleTimeout ends a replay once the DLQ has been drained for this long.
+const replayIdleTimeout = 10 * time.Second
+
+type ReplayOptions struct {
+	// Limit stops the replay after this many messages; zero replays everything.
+	Limit int
+	// GroupID is the consumer group used to track replay progress. Defaults to <group>.dlq-replay.
+	GroupID string
+}
+
+// ReplayDLQ republishes the messages of <topic>.dlq to their original topic with a fresh
+// retry budget, committing each one once producer reports it delivered. It returns the number
+// of replayed messages once the DLQ is drained, Limit is reached or ctx is done.
+func ReplayDLQ(ctx context.Context, cfg KafkaConfig, topic string, producer *Producer, opts ReplayOptions) (int, error) {
+	log := logger.GetLogger().AddTraceInfoContextRequest(ctx)
+
+	if producer == nil {
+		return 0, ErrNilRetryProducer
+	}
+
+	groupID := opts.GroupID
+	if groupID == "" {
+		groupID = cfg.GroupID + ".dlq-replay"
+	}
+
+	cfgMap := newConsumerConfigMap(cfg)
+	cfgMap["group.id"] = groupID
+	cfgMap["auto.offset.reset"] = "earliest"
+
+	cs, err := kafka.NewConsumer(&cfgMap)
+	if err != nil {
+		return 0, fmt.Errorf("new consumer: %w", err)
+	}
+	defer func() {
+		if err := cs.Close(); err != nil {
+			log.Err(err).Msg("kafka dlq replay consumer close failed")
+		}
+	}()
+
+	dlq := DLQTopic(topic)
+	if err = cs.Subscribe(dlq, nil); err != nil {
+		return 0, fmt.Errorf("subscribe: %w", err)
+	}
+
+	replayed := 0
+	lastMessage := time.Now()
+	for opts.Limit == 0 || replayed < opts.Limit {
+		if ctx.Err() != nil {
+			return replayed, nil
+		}
+
+		msg, err := cs.ReadMessage(readTimeout)
+		if err != nil {
+			var kerr kafka.Error
+			if errors.As(err, &kerr) && kerr.Code() == kafka.ErrTimedOut {
+				if time.Since(lastMessage) > replayIdleTimeout {
+					break
+				}
+				continue
+			}
+			return replayed, fmt.Errorf("read message: %w", err)
+		}
+		lastMessage = time.Now()
+
+		target := topic
+		if v, ok := headerValue(msg.Headers, HeaderOriginalTopic); ok {
+			target = v
+		}
+
+		headers := make([]kafka.Header, 0, len(msg.Headers))
+		for _, h := range msg.Headers {
+			switch h.Key {
+			case HeaderError, HeaderAttempt, HeaderRetryNotBefore,
+				HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset:
+				continue
+			}
+			headers = append(headers, h)
+		}
+
+		err = producer.PublishMessageSync(ctx, &kafka.Message{
+			Key:     msg.Key,
+			Value:   msg.Value,
+			Headers: headers,
+			TopicPartition: kafka.TopicPartition{
+				Topic:     &target,
+				Partition: kafka.PartitionAny,
+			},
+		})
+		if err != nil {
+			return replayed, fmt.Errorf("publish to %s: %w", target, err)
+		}
+
+		if _, err = cs.CommitMessage(msg); err != nil {
+			return replayed, fmt.Errorf("commit: %w", err)
+		}
+		replayed++
+	}
+
+	log.Info().Str("topic", dlq).Int("replayed", replayed).Msg("kafka dlq replay finished")
+	return replayed, nil
+}
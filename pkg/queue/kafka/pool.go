@@ -0,0 +1,268 @@
+package kafka
+
+import (
+	"context"
+	logger "go-source/pkg/log"
+	"go-source/pkg/metric"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+const (
+	defaultLaneBuffer     = 16
+	defaultCommitInterval = time.Second
+)
+
+// WorkerPoolConfig handles messages on Lanes goroutines in parallel. Messages with the same
+// key always go to the same lane, so they are handled in order.
+type WorkerPoolConfig struct {
+	Lanes          int
+	LaneBuffer     int
+	CommitInterval time.Duration
+}
+
+type workerPool struct {
+	lanes          []chan *kafka.Message
+	results        chan poolResult
+	wg             sync.WaitGroup
+	inFlight       sync.WaitGroup
+	commitInterval time.Duration
+	lastCommit     time.Time
+
+	// offsets tracks dispatched offsets per partition.
+	offsets map[partitionKey]*partitionOffsets
+	mu      sync.Mutex
+}
+
+type poolResult struct {
+	ctx context.Context
+	msg *kafka.Message
+	err error
+}
+
+// partitionOffsets keeps dispatched offsets in order so that only the lowest contiguous
+// completed offset is committed.
+type partitionOffsets struct {
+	dispatched []kafka.Offset
+	done       map[kafka.Offset]struct{}
+}
+
+// SetWorkerPool enables parallel handling with per-key ordering. It must be set before Start.
+func (s *Consumer) SetWorkerPool(cfg WorkerPoolConfig) {
+	if cfg.Lanes <= 0 {
+		return
+	}
+	if cfg.LaneBuffer <= 0 {
+		cfg.LaneBuffer = defaultLaneBuffer
+	}
+	if cfg.CommitInterval <= 0 {
+		cfg.CommitInterval = defaultCommitInterval
+	}
+
+	pool := &workerPool{
+		lanes: make([]chan *kafka.Message, cfg.Lanes),
+		// results is also read while dispatch and the waits for the workers block, so a
+		// full channel only holds the workers back until it is read
+		results:        make(chan poolResult, cfg.Lanes*(cfg.LaneBuffer+1)),
+		commitInterval: cfg.CommitInterval,
+		lastCommit:     time.Now(),
+		offsets:        make(map[partitionKey]*partitionOffsets),
+	}
+	for i := range pool.lanes {
+		pool.lanes[i] = make(chan *kafka.Message, cfg.LaneBuffer)
+	}
+
+	s.mu.Lock()
+	s.pool = pool
+	s.mu.Unlock()
+}
+
+func (s *Consumer) startWorkers(ctx context.Context) {
+	for _, lane := range s.pool.lanes {
+		s.pool.wg.Add(1)
+		go func(lane chan *kafka.Message) {
+			defer s.pool.wg.Done()
+			for msg := range lane {
+				newCtx, err := s.process(ctx, msg)
+				s.pool.results <- poolResult{ctx: newCtx, msg: msg, err: err}
+				metric.AddKafkaConsumerInFlight(*msg.TopicPartition.Topic, -1)
+				s.pool.inFlight.Done()
+			}
+		}(lane)
+	}
+}
+
+// dispatch sends msg to its lane. It blocks while the lane is full and applies the results
+// of the workers meanwhile.
+func (s *Consumer) dispatch(msg *kafka.Message) {
+	tp := msg.TopicPartition
+	key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+
+	s.pool.mu.Lock()
+	po, ok := s.pool.offsets[key]
+	if !ok {
+		po = &partitionOffsets{done: make(map[kafka.Offset]struct{})}
+		s.pool.offsets[key] = po
+	}
+	po.dispatched = append(po.dispatched, tp.Offset)
+	s.pool.mu.Unlock()
+
+	s.pool.inFlight.Add(1)
+	metric.AddKafkaConsumerInFlight(*tp.Topic, 1)
+	lane := s.pool.lanes[laneOf(msg, len(s.pool.lanes))]
+	for {
+		select {
+		case lane <- msg:
+			return
+		case res := <-s.pool.results:
+			s.applyResult(res)
+		}
+	}
+}
+
+func laneOf(msg *kafka.Message, lanes int) int {
+	h := fnv.New32a()
+	if len(msg.Key) > 0 {
+		_, _ = h.Write(msg.Key)
+	} else {
+		// keyless messages keep partition order
+		_, _ = h.Write([]byte(*msg.TopicPartition.Topic + ":" + strconv.Itoa(int(msg.TopicPartition.Partition))))
+	}
+	return int(h.Sum32() % uint32(lanes))
+}
+
+// collect applies the finished results and commits on the commit interval.
+func (s *Consumer) collect() {
+	for {
+		select {
+		case res := <-s.pool.results:
+			s.applyResult(res)
+		default:
+			if time.Since(s.pool.lastCommit) >= s.pool.commitInterval {
+				s.pool.lastCommit = time.Now()
+				if err := s.commitPending(nil); err != nil {
+					logger.GetLogger().Err(err).Msg("kafka commit failed")
+				}
+			}
+			return
+		}
+	}
+}
+
+func (s *Consumer) applyResult(res poolResult) {
+	// without a retry policy a failed message does not hold back its partition,
+	// same as the sequential mode; with one it is rewound unless it was republished
+	if res.err != nil && !s.onHandlerError(res.ctx, res.msg, res.err) && s.retryPolicy != nil {
+		return
+	}
+	s.complete(res.msg.TopicPartition)
+}
+
+// complete marks tp handled and moves the committable offset over every contiguous handled offset.
+func (s *Consumer) complete(tp kafka.TopicPartition) {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	po, ok := s.pool.offsets[partitionKey{topic: *tp.Topic, partition: tp.Partition}]
+	if !ok || !po.isDispatched(tp.Offset) {
+		// the partition was rewound or revoked while the message was in flight
+		return
+	}
+	po.done[tp.Offset] = struct{}{}
+
+	committable := kafka.OffsetInvalid
+	for len(po.dispatched) > 0 {
+		head := po.dispatched[0]
+		if _, ok := po.done[head]; !ok {
+			break
+		}
+		delete(po.done, head)
+		po.dispatched = po.dispatched[1:]
+		committable = head
+	}
+
+	if committable != kafka.OffsetInvalid {
+		tp.Offset = committable
+		s.markOffset(tp)
+	}
+}
+
+func (po *partitionOffsets) isDispatched(offset kafka.Offset) bool {
+	for _, o := range po.dispatched {
+		if o == offset {
+			return true
+		}
+	}
+	return false
+}
+
+// rewind forgets the dispatched offsets of tp from tp.Offset on, as they will be read again.
+func (s *Consumer) rewind(tp kafka.TopicPartition) {
+	if s.pool == nil {
+		return
+	}
+
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	po, ok := s.pool.offsets[partitionKey{topic: *tp.Topic, partition: tp.Partition}]
+	if !ok {
+		return
+	}
+
+	for i, offset := range po.dispatched {
+		if offset >= tp.Offset {
+			for _, o := range po.dispatched[i:] {
+				delete(po.done, o)
+			}
+			po.dispatched = po.dispatched[:i]
+			break
+		}
+	}
+}
+
+// drain waits for every dispatched message to be handled and applies the results.
+func (s *Consumer) drain() {
+	s.awaitWorkers(s.pool.inFlight.Wait)
+}
+
+// stopWorkers drains the lanes and stops the workers.
+func (s *Consumer) stopWorkers() {
+	for _, lane := range s.pool.lanes {
+		close(lane)
+	}
+	s.awaitWorkers(s.pool.wg.Wait)
+}
+
+// awaitWorkers applies the results of the workers until wait returns, so that no worker
+// blocks on a full results channel while it is waited for.
+func (s *Consumer) awaitWorkers(wait func()) {
+	done := make(chan struct{})
+	go func() {
+		wait()
+		close(done)
+	}()
+
+	for {
+		select {
+		case res := <-s.pool.results:
+			s.applyResult(res)
+		case <-done:
+			s.collect()
+			return
+		}
+	}
+}
+
+func (s *Consumer) forgetOffsets(partitions []kafka.TopicPartition) {
+	s.pool.mu.Lock()
+	defer s.pool.mu.Unlock()
+
+	for _, p := range partitions {
+		delete(s.pool.offsets, partitionKey{topic: *p.Topic, partition: p.Partition})
+	}
+}
@@ -0,0 +1,150 @@
+package kafka
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+
+	logger "go-source/pkg/log"
+)
+
+func newTestPoolConsumer(topic string, partition int32, offsets ...kafka.Offset) *Consumer {
+	s := &Consumer{
+		pending: make(map[partitionKey]kafka.TopicPartition),
+		pool:    &workerPool{offsets: make(map[partitionKey]*partitionOffsets)},
+	}
+	s.pool.offsets[partitionKey{topic: topic, partition: partition}] = &partitionOffsets{
+		dispatched: offsets,
+		done:       make(map[kafka.Offset]struct{}),
+	}
+	return s
+}
+
+func TestConsumer_CompleteCommitsLowestContiguousOffset(t *testing.T) {
+	topic := "orders"
+	tp := func(offset kafka.Offset) kafka.TopicPartition {
+		return kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: offset}
+	}
+
+	tests := []struct {
+		name       string
+		completed  []kafka.Offset
+		rewindTo   kafka.Offset
+		wantCommit kafka.Offset
+	}{
+		{name: "nothing done", wantCommit: kafka.OffsetInvalid},
+		{name: "head not done", completed: []kafka.Offset{11, 12}, wantCommit: kafka.OffsetInvalid},
+		{name: "head done", completed: []kafka.Offset{10}, wantCommit: 11},
+		{name: "gap", completed: []kafka.Offset{10, 11, 13}, wantCommit: 12},
+		{name: "out of order", completed: []kafka.Offset{13, 11, 12, 10}, wantCommit: 14},
+		{name: "not dispatched", completed: []kafka.Offset{10, 20}, wantCommit: 11},
+		{name: "rewound", rewindTo: 12, completed: []kafka.Offset{10, 11, 12, 13}, wantCommit: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestPoolConsumer(topic, 0, 10, 11, 12, 13)
+			if tt.rewindTo != 0 {
+				s.rewind(tp(tt.rewindTo))
+			}
+			for _, offset := range tt.completed {
+				s.complete(tp(offset))
+			}
+
+			got := kafka.OffsetInvalid
+			if pending, ok := s.pending[partitionKey{topic: topic, partition: 0}]; ok {
+				got = pending.Offset
+			}
+			if got != tt.wantCommit {
+				t.Fatalf("committable offset = %v, want %v", got, tt.wantCommit)
+			}
+		})
+	}
+}
+
+func TestConsumer_RewindForgetsLaterOffsets(t *testing.T) {
+	topic := "orders"
+	s := newTestPoolConsumer(topic, 0, 10, 11, 12, 13)
+	s.complete(kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 12})
+
+	s.rewind(kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: 11})
+
+	po := s.pool.offsets[partitionKey{topic: topic, partition: 0}]
+	if len(po.dispatched) != 1 || po.dispatched[0] != 10 {
+		t.Fatalf("dispatched = %v, want [10]", po.dispatched)
+	}
+	if len(po.done) != 0 {
+		t.Fatalf("done = %v, want none", po.done)
+	}
+}
+
+func TestLaneOf(t *testing.T) {
+	const lanes = 8
+	topic := "orders"
+	msg := func(key string, partition int32) *kafka.Message {
+		m := &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: partition}}
+		if key != "" {
+			m.Key = []byte(key)
+		}
+		return m
+	}
+
+	// a key always goes to the same lane whatever its partition, so its messages stay in order
+	used := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		key := "user-" + strconv.Itoa(i)
+		lane := laneOf(msg(key, 0), lanes)
+		if lane < 0 || lane >= lanes {
+			t.Fatalf("laneOf(%s) = %d, out of range", key, lane)
+		}
+		if other := laneOf(msg(key, 3), lanes); other != lane {
+			t.Fatalf("laneOf(%s) = %d then %d", key, lane, other)
+		}
+		used[lane] = true
+	}
+	if len(used) < lanes/2 {
+		t.Fatalf("100 keys use %d lanes of %d", len(used), lanes)
+	}
+
+	// keyless messages keep the order of their partition
+	if laneOf(msg("", 1), lanes) != laneOf(msg("", 1), lanes) {
+		t.Fatal("keyless messages of a partition go to different lanes")
+	}
+}
+
+func TestConsumer_StopWorkersWithFullResults(t *testing.T) {
+	logger.InitLog("kafka-test")
+
+	topic := "orders"
+	s := &Consumer{
+		pending: make(map[partitionKey]kafka.TopicPartition),
+		handler: func(ctx context.Context, key, value []byte) error { return nil },
+	}
+	// one lane of one message keeps two results in the channel, a third worker result must not block
+	s.SetWorkerPool(WorkerPoolConfig{Lanes: 1, LaneBuffer: 1, CommitInterval: time.Hour})
+	s.startWorkers(context.Background())
+
+	for offset := kafka.Offset(0); offset < 3; offset++ {
+		s.dispatch(&kafka.Message{
+			TopicPartition: kafka.TopicPartition{Topic: &topic, Partition: 0, Offset: offset},
+			Key:            []byte("user-1"),
+		})
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		s.stopWorkers()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("stopWorkers() blocked on the results of the workers")
+	}
+
+	if pending := s.pending[partitionKey{topic: topic, partition: 0}]; pending.Offset != 3 {
+		t.Fatalf("committable offset = %v, want 3", pending.Offset)
+	}
+}
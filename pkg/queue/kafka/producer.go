@@ -4,8 +4,8 @@ import (
 	"context"
 	"encoding/json"
 	logger "go-source/pkg/log"
-	"go-source/pkg/utils"
 	"hash/crc32"
+	"sync"
 
 	"github.com/confluentinc/confluent-kafka-go/kafka"
 )
@@ -18,6 +18,9 @@ type Producer struct {
 	pr            *kafka.Producer
 	topic         string
 	numPartitions int32
+
+	reportsDone chan struct{}
+	closeOnce   sync.Once
 }
 
 func NewProducer(cfg KafkaConfig, topic string, numPartitions ...int32) *Producer {
@@ -56,14 +59,17 @@ func NewProducer(cfg KafkaConfig, topic string, numPartitions ...int32) *Produce
 	log.Info().Msgf("init kafka producer success : TOPIC = %v", topic)
 
 	res := &Producer{
-		pr:    pr,
-		topic: topic,
+		pr:          pr,
+		topic:       topic,
+		reportsDone: make(chan struct{}),
 	}
 
 	if len(numPartitions) > 0 {
 		res.numPartitions = numPartitions[0]
 	}
 
+	go res.handleDeliveryReports()
+
 	return res
 }
 
@@ -78,173 +84,89 @@ func marshal(val interface{}) ([]byte, error) {
 	}
 }
 
-func (s *Producer) Publish(ctx context.Context, key, value interface{}) error {
+// newMessage builds a message for topic with the trace headers of ctx. Every publish method
+// goes through it.
+func (s *Producer) newMessage(ctx context.Context, topic string, partition int32, key, value interface{}) (*kafka.Message, error) {
 	keyData, err := marshal(key)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	valueData, err := marshal(value)
 	if err != nil {
-		return err
-	}
-
-	var header []byte
-	traceInfo := utils.GetRequestIdByContext(ctx)
-	if traceInfo != nil {
-		header, err = marshal(traceInfo)
-		if err != nil {
-			return err
-		}
+		return nil, err
 	}
 
 	msg := &kafka.Message{
 		Key:   keyData,
 		Value: valueData,
-		Headers: []kafka.Header{
-			{
-				Key:   utils.KeyTraceInfo,
-				Value: header,
-			},
-		},
 		TopicPartition: kafka.TopicPartition{
-			Topic:     &s.topic,
-			Partition: kafka.PartitionAny,
+			Topic:     &topic,
+			Partition: partition,
 		},
 	}
-	if err = s.pr.Produce(msg, nil); err != nil {
-		return err
+	if err = injectTraceHeaders(ctx, msg); err != nil {
+		return nil, err
 	}
-	return nil
+
+	return msg, nil
 }
 
-func (s *Producer) PublishWithPartition(ctx context.Context, key, value interface{}, partition int32) error {
-	keyData, err := marshal(key)
-	if err != nil {
-		return err
-	}
-	valueData, err := marshal(value)
+func (s *Producer) Publish(ctx context.Context, key, value interface{}) error {
+	msg, err := s.newMessage(ctx, s.topic, kafka.PartitionAny, key, value)
 	if err != nil {
 		return err
 	}
+	return s.pr.Produce(msg, nil)
+}
 
-	msg := &kafka.Message{
-		Key:   keyData,
-		Value: valueData,
-		TopicPartition: kafka.TopicPartition{
-			Topic:     &s.topic,
-			Partition: partition,
-		},
-	}
-	if err = s.pr.Produce(msg, nil); err != nil {
+func (s *Producer) PublishWithPartition(ctx context.Context, key, value interface{}, partition int32) error {
+	msg, err := s.newMessage(ctx, s.topic, partition, key, value)
+	if err != nil {
 		return err
 	}
-	return nil
+	return s.pr.Produce(msg, nil)
 }
 
 // PublishWithPartitionCRC32 publish message with partition is crc32(key) % numPartitions
 func (s *Producer) PublishWithPartitionCRC32(ctx context.Context, key, value interface{}) error {
-	keyData, err := marshal(key)
-	if err != nil {
-		return err
-	}
-
-	valueData, err := marshal(value)
+	msg, err := s.newMessage(ctx, s.topic, kafka.PartitionAny, key, value)
 	if err != nil {
 		return err
 	}
 
-	var header []byte
-	traceInfo := utils.GetRequestIdByContext(ctx)
-	if traceInfo != nil {
-		header, err = marshal(traceInfo)
-		if err != nil {
-			return err
-		}
-	}
-
-	partition := kafka.PartitionAny
 	if s.numPartitions > 0 {
-		partition = int32(crc32.ChecksumIEEE(keyData)) % s.numPartitions
+		partition := int32(crc32.ChecksumIEEE(msg.Key)) % s.numPartitions
 		if partition < 0 {
 			partition = -partition
 		}
+		msg.TopicPartition.Partition = partition
 	}
 
-	msg := &kafka.Message{
-		Key:   keyData,
-		Value: valueData,
-		Headers: []kafka.Header{
-			{
-				Key:   utils.KeyTraceInfo,
-				Value: header,
-			},
-		},
-		TopicPartition: kafka.TopicPartition{
-			Topic:     &s.topic,
-			Partition: partition,
-		},
-	}
-	if err = s.pr.Produce(msg, nil); err != nil {
-		return err
-	}
-
-	return nil
+	return s.pr.Produce(msg, nil)
 }
 
 func (s *Producer) PublishBytes(ctx context.Context, key, value []byte) error {
-	msg := &kafka.Message{
-		Key:   key,
-		Value: value,
-		TopicPartition: kafka.TopicPartition{
-			Topic:     &s.topic,
-			Partition: kafka.PartitionAny,
-		},
+	msg, err := s.newMessage(ctx, s.topic, kafka.PartitionAny, key, value)
+	if err != nil {
+		return err
 	}
 	return s.pr.Produce(msg, nil)
 }
 
+// PublishMessage publishes msg as is, adding the trace headers of ctx when it has them.
 func (s *Producer) PublishMessage(ctx context.Context, msg *kafka.Message) error {
+	if err := injectTraceHeaders(ctx, msg); err != nil {
+		return err
+	}
 	return s.pr.Produce(msg, nil)
 }
 
 func (s *Producer) PublishWithTopic(ctx context.Context, topic string, key, value interface{}) error {
-	keyData, err := marshal(key)
+	msg, err := s.newMessage(ctx, topic, kafka.PartitionAny, key, value)
 	if err != nil {
 		return err
 	}
-	valueData, err := marshal(value)
-	if err != nil {
-		return err
-	}
-
-	var header []byte
-	traceInfo := utils.GetRequestIdByContext(ctx)
-	if traceInfo != nil {
-		header, err = marshal(traceInfo)
-		if err != nil {
-			return err
-		}
-	}
-
-	msg := &kafka.Message{
-		Value: valueData,
-		Key:   keyData,
-		Headers: []kafka.Header{
-			{
-				Key:   utils.KeyTraceInfo,
-				Value: header,
-			},
-		},
-		TopicPartition: kafka.TopicPartition{
-			Topic:     &topic,
-			Partition: kafka.PartitionAny,
-		},
-	}
-
-	if err := s.pr.Produce(msg, nil); err != nil {
-		return err
-	}
-	return nil
+	return s.pr.Produce(msg, nil)
 }
 
 func (s *Producer) GetTopicName() string {
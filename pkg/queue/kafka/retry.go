@@ -0,0 +1,226 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	logger "go-source/pkg/log"
+	"strconv"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+const (
+	HeaderError             = "x-error"
+	HeaderAttempt           = "x-attempt"
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderRetryNotBefore    = "x-retry-not-before"
+)
+
+const (
+	// republishBackoff is how long a partition is paused when a failed message could not be republished.
+	republishBackoff = 5 * time.Second
+	// republishTimeout bounds the wait for the delivery reports of republished messages.
+	republishTimeout = 30 * time.Second
+)
+
+var ErrNilRetryProducer = errors.New("retry producer is nil")
+
+// RetryPolicy routes messages whose handler failed to tiered retry topics and then to a DLQ.
+// A message that fails attempt n (starting at 1) is published to <topic>.retry.<n> and handled
+// again after Delays[n-1]; once every tier is exhausted it is published to <topic>.dlq.
+type RetryPolicy struct {
+	Delays []time.Duration
+}
+
+func RetryTopic(topic string, tier int) string {
+	return fmt.Sprintf("%s.retry.%d", topic, tier)
+}
+
+func DLQTopic(topic string) string {
+	return topic + ".dlq"
+}
+
+func (p RetryPolicy) topics(sources []string) []string {
+	var topics []string
+	for _, topic := range sources {
+		for tier := 1; tier <= len(p.Delays); tier++ {
+			topics = append(topics, RetryTopic(topic, tier))
+		}
+	}
+	return topics
+}
+
+// SetRetryPolicy enables retry topics and the DLQ, republishing failed messages with producer.
+// The consumer also subscribes to the retry topics of its topics. It must be set before Start.
+func (s *Consumer) SetRetryPolicy(policy RetryPolicy, producer *Producer) {
+	s.mu.Lock()
+	s.retryPolicy = &policy
+	s.retryProducer = producer
+	s.mu.Unlock()
+}
+
+// handleFailure republishes msg to the next retry tier or the DLQ. It reports whether the
+// message may be committed, which is only once the republished message is delivered.
+func (s *Consumer) handleFailure(ctx context.Context, msg *kafka.Message, handlerErr error) bool {
+	log := logger.GetLogger().AddTraceInfoContextRequest(ctx)
+
+	retry, attempt, err := s.retryMessage(ctx, msg, handlerErr)
+	if err == nil {
+		err = s.republish(ctx, retry)
+	}
+	if err != nil {
+		log.Err(err).Str("topic", *retry.TopicPartition.Topic).Msg("kafka republish failed message failed")
+		s.pauseUntil(msg.TopicPartition, time.Now().Add(republishBackoff))
+		return false
+	}
+
+	log.Warn().Err(handlerErr).Str("topic", *retry.TopicPartition.Topic).Int("attempt", attempt).Msg("kafka message sent to retry")
+	return true
+}
+
+// retryMessage returns the message republishing msg to the next retry tier or the DLQ, with
+// the trace headers of ctx, and its attempt.
+func (s *Consumer) retryMessage(ctx context.Context, msg *kafka.Message, handlerErr error) (*kafka.Message, int, error) {
+	origTopic := *msg.TopicPartition.Topic
+	if v, ok := headerValue(msg.Headers, HeaderOriginalTopic); ok {
+		origTopic = v
+	}
+
+	attempt := 1
+	if v, ok := headerValue(msg.Headers, HeaderAttempt); ok {
+		if n, err := strconv.Atoi(v); err == nil {
+			attempt = n + 1
+		}
+	}
+
+	headers := retryHeaders(msg, handlerErr, attempt)
+
+	target := DLQTopic(origTopic)
+	if attempt <= len(s.retryPolicy.Delays) {
+		target = RetryTopic(origTopic, attempt)
+		notBefore := time.Now().Add(s.retryPolicy.Delays[attempt-1])
+		headers = append(headers, kafka.Header{
+			Key:   HeaderRetryNotBefore,
+			Value: []byte(strconv.FormatInt(notBefore.UnixMilli(), 10)),
+		})
+	}
+
+	retry := &kafka.Message{
+		Key:     msg.Key,
+		Value:   msg.Value,
+		Headers: headers,
+		TopicPartition: kafka.TopicPartition{
+			Topic:     &target,
+			Partition: kafka.PartitionAny,
+		},
+	}
+	return retry, attempt, injectTraceHeaders(ctx, retry)
+}
+
+// republish publishes the retry messages and waits for their delivery reports. The wait does
+// not inherit the cancellation of ctx, as failed messages are also republished on shutdown.
+func (s *Consumer) republish(ctx context.Context, msgs ...*kafka.Message) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), republishTimeout)
+	defer cancel()
+
+	return s.retryProducer.produceSync(ctx, msgs...)
+}
+
+// retryHeaders keeps the message headers, replaces the retry bookkeeping headers and records
+// where the message was first consumed from.
+func retryHeaders(msg *kafka.Message, handlerErr error, attempt int) []kafka.Header {
+	headers := make([]kafka.Header, 0, len(msg.Headers)+5)
+	for _, h := range msg.Headers {
+		switch h.Key {
+		case HeaderError, HeaderAttempt, HeaderRetryNotBefore:
+			continue
+		}
+		headers = append(headers, h)
+	}
+
+	if _, ok := headerValue(msg.Headers, HeaderOriginalTopic); !ok {
+		headers = append(headers,
+			kafka.Header{Key: HeaderOriginalTopic, Value: []byte(*msg.TopicPartition.Topic)},
+			kafka.Header{Key: HeaderOriginalPartition, Value: []byte(strconv.Itoa(int(msg.TopicPartition.Partition)))},
+			kafka.Header{Key: HeaderOriginalOffset, Value: []byte(strconv.FormatInt(int64(msg.TopicPartition.Offset), 10))},
+		)
+	}
+
+	return append(headers,
+		kafka.Header{Key: HeaderError, Value: []byte(handlerErr.Error())},
+		kafka.Header{Key: HeaderAttempt, Value: []byte(strconv.Itoa(attempt))},
+	)
+}
+
+// notBefore returns when a retry message is due, or the zero time if it has no delay.
+func notBefore(msg *kafka.Message) time.Time {
+	v, ok := headerValue(msg.Headers, HeaderRetryNotBefore)
+	if !ok {
+		return time.Time{}
+	}
+
+	ms, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(ms)
+}
+
+func headerValue(headers []kafka.Header, key string) (string, bool) {
+	for _, h := range headers {
+		if h.Key == key {
+			return string(h.Value), true
+		}
+	}
+	return "", false
+}
+
+// pauseUntil rewinds the partition to tp and pauses it until at, so other partitions keep flowing.
+// A partition being revoked is left alone: its next owner reads it again from the committed offset.
+func (s *Consumer) pauseUntil(tp kafka.TopicPartition, at time.Time) {
+	log := logger.GetLogger()
+
+	key := partitionKey{topic: *tp.Topic, partition: tp.Partition}
+	if _, ok := s.revoking[key]; ok {
+		return
+	}
+
+	if err := s.cs.Pause([]kafka.TopicPartition{tp}); err != nil {
+		log.Err(err).Interface("topicPartition", tp).Msg("kafka pause partition failed")
+		return
+	}
+
+	if err := s.cs.Seek(tp, seekTimeoutMs); err != nil {
+		log.Err(err).Interface("topicPartition", tp).Msg("kafka seek paused partition failed")
+	}
+
+	s.rewind(tp)
+	s.paused[key] = pausedPartition{tp: tp, resumeAt: at}
+}
+
+// resumeDue resumes the paused partitions whose delay has elapsed.
+func (s *Consumer) resumeDue() {
+	now := time.Now()
+	for key, p := range s.paused {
+		if now.Before(p.resumeAt) {
+			continue
+		}
+
+		if err := s.cs.Resume([]kafka.TopicPartition{p.tp}); err != nil {
+			logger.GetLogger().Err(err).Interface("topicPartition", p.tp).Msg("kafka resume partition failed")
+			continue
+		}
+		delete(s.paused, key)
+	}
+}
+
+func (s *Consumer) forgetPaused(partitions []kafka.TopicPartition) {
+	for _, p := range partitions {
+		delete(s.paused, partitionKey{topic: *p.Topic, partition: p.Partition})
+	}
+}
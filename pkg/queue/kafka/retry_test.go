@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func TestConsumer_RetryMessage(t *testing.T) {
+	s := &Consumer{retryPolicy: &RetryPolicy{Delays: []time.Duration{time.Second, time.Minute}}}
+	handlerErr := errors.New("handler failed")
+
+	tests := []struct {
+		name        string
+		topic       string
+		attempt     string
+		wantTopic   string
+		wantAttempt int
+		wantDelay   time.Duration
+	}{
+		{name: "first failure", topic: "orders", wantTopic: "orders.retry.1", wantAttempt: 1, wantDelay: time.Second},
+		{name: "second failure", topic: "orders.retry.1", attempt: "1", wantTopic: "orders.retry.2", wantAttempt: 2, wantDelay: time.Minute},
+		{name: "retries exhausted", topic: "orders.retry.2", attempt: "2", wantTopic: "orders.dlq", wantAttempt: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := &kafka.Message{
+				Key:            []byte("order-1"),
+				Value:          []byte(`{"id":"order-1"}`),
+				TopicPartition: kafka.TopicPartition{Topic: &tt.topic, Partition: 2, Offset: 41},
+				Headers:        []kafka.Header{{Key: "x-message-id", Value: []byte("m-1")}},
+			}
+			if tt.attempt != "" {
+				msg.Headers = append(msg.Headers,
+					kafka.Header{Key: HeaderOriginalTopic, Value: []byte("orders")},
+					kafka.Header{Key: HeaderAttempt, Value: []byte(tt.attempt)},
+					kafka.Header{Key: HeaderError, Value: []byte("previous error")},
+					kafka.Header{Key: HeaderRetryNotBefore, Value: []byte("0")},
+				)
+			}
+
+			start := time.Now()
+			retry, attempt, err := s.retryMessage(context.Background(), msg, handlerErr)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got := *retry.TopicPartition.Topic; got != tt.wantTopic {
+				t.Fatalf("topic = %q, want %q", got, tt.wantTopic)
+			}
+			if attempt != tt.wantAttempt {
+				t.Fatalf("attempt = %d, want %d", attempt, tt.wantAttempt)
+			}
+
+			headers := make(map[string][]string)
+			for _, h := range retry.Headers {
+				headers[h.Key] = append(headers[h.Key], string(h.Value))
+			}
+			for _, key := range []string{HeaderError, HeaderAttempt, HeaderOriginalTopic, "x-message-id"} {
+				if len(headers[key]) != 1 {
+					t.Fatalf("header %s = %v, want one value", key, headers[key])
+				}
+			}
+			if headers[HeaderError][0] != handlerErr.Error() || headers[HeaderAttempt][0] != strconv.Itoa(tt.wantAttempt) {
+				t.Fatalf("headers = %v", headers)
+			}
+			if headers[HeaderOriginalTopic][0] != "orders" {
+				t.Fatalf("original topic = %q, want orders", headers[HeaderOriginalTopic][0])
+			}
+
+			due := notBefore(retry)
+			if tt.wantDelay == 0 {
+				if !due.IsZero() || len(headers[HeaderRetryNotBefore]) != 0 {
+					t.Fatalf("not before = %v, want none for the DLQ", due)
+				}
+				return
+			}
+			if due.Before(start.Add(tt.wantDelay).Truncate(time.Millisecond)) || due.After(time.Now().Add(tt.wantDelay)) {
+				t.Fatalf("not before = %v, want %v after %v", due, tt.wantDelay, start)
+			}
+		})
+	}
+}
+
+func TestNotBefore(t *testing.T) {
+	at := time.UnixMilli(1700000000000)
+
+	tests := []struct {
+		name    string
+		headers []kafka.Header
+		want    time.Time
+	}{
+		{name: "no header"},
+		{name: "invalid header", headers: []kafka.Header{{Key: HeaderRetryNotBefore, Value: []byte("soon")}}},
+		{name: "due time", headers: []kafka.Header{{Key: HeaderRetryNotBefore, Value: []byte("1700000000000")}}, want: at},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := notBefore(&kafka.Message{Headers: tt.headers}); !got.Equal(tt.want) {
+				t.Fatalf("notBefore() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
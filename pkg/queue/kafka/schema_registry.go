@@ -0,0 +1,100 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrSchemaNotFound = errors.New("schema not found")
+
+type SchemaType string
+
+const (
+	SchemaTypeJSON     SchemaType = "JSON"
+	SchemaTypeProtobuf SchemaType = "PROTOBUF"
+	SchemaTypeAvro     SchemaType = "AVRO"
+)
+
+type Schema struct {
+	ID         int
+	Subject    string
+	Version    int
+	Type       SchemaType
+	Definition string
+}
+
+// SchemaRegistry resolves schemas by subject and ID, like the Confluent schema registry.
+type SchemaRegistry interface {
+	// Register adds schema under subject and returns it with its ID and version. Registering a
+	// definition the subject already has returns the existing schema.
+	Register(ctx context.Context, subject string, schema Schema) (Schema, error)
+	GetByID(ctx context.Context, id int) (Schema, error)
+	GetLatest(ctx context.Context, subject string) (Schema, error)
+}
+
+// SubjectName returns the subject of the values of topic (Confluent TopicNameStrategy).
+func SubjectName(topic string) string {
+	return topic + "-value"
+}
+
+// MemorySchemaRegistry is an in-process SchemaRegistry for tests and local development.
+type MemorySchemaRegistry struct {
+	mu       sync.RWMutex
+	nextID   int
+	byID     map[int]Schema
+	subjects map[string][]Schema
+}
+
+func NewMemorySchemaRegistry() *MemorySchemaRegistry {
+	return &MemorySchemaRegistry{
+		nextID:   1,
+		byID:     make(map[int]Schema),
+		subjects: make(map[string][]Schema),
+	}
+}
+
+func (r *MemorySchemaRegistry) Register(ctx context.Context, subject string, schema Schema) (Schema, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := r.subjects[subject]
+	for _, v := range versions {
+		if v.Type == schema.Type && v.Definition == schema.Definition {
+			return v, nil
+		}
+	}
+
+	schema.ID = r.nextID
+	schema.Subject = subject
+	schema.Version = len(versions) + 1
+	r.nextID++
+
+	r.byID[schema.ID] = schema
+	r.subjects[subject] = append(versions, schema)
+
+	return schema, nil
+}
+
+func (r *MemorySchemaRegistry) GetByID(ctx context.Context, id int) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schema, ok := r.byID[id]
+	if !ok {
+		return Schema{}, fmt.Errorf("%w: id %d", ErrSchemaNotFound, id)
+	}
+	return schema, nil
+}
+
+func (r *MemorySchemaRegistry) GetLatest(ctx context.Context, subject string) (Schema, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	versions := r.subjects[subject]
+	if len(versions) == 0 {
+		return Schema{}, fmt.Errorf("%w: subject %s", ErrSchemaNotFound, subject)
+	}
+	return versions[len(versions)-1], nil
+}
@@ -0,0 +1,179 @@
+package kafka
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// wire format: magic byte 0, 4-byte big-endian schema ID, payload
+const (
+	wireMagicByte    = 0
+	wireHeaderLength = 5
+)
+
+var ErrInvalidWireFormat = errors.New("invalid confluent wire format")
+
+const (
+	// KeyMessageTopic holds the topic of the consumed message in the handler context.
+	KeyMessageTopic = "kafka_message_topic"
+	// KeyMessage holds the consumed message in the handler context.
+	KeyMessage = "kafka_message"
+)
+
+func TopicFromContext(ctx context.Context) string {
+	topic, _ := ctx.Value(KeyMessageTopic).(string)
+	return topic
+}
+
+// OriginalTopicFromContext returns the topic the consumed message was first published to:
+// the x-original-topic header of a message read from a retry topic, or else its topic. The
+// schema subject of the message value is derived from it.
+func OriginalTopicFromContext(ctx context.Context) string {
+	if msg, ok := MessageFromContext(ctx); ok {
+		if topic, ok := headerValue(msg.Headers, HeaderOriginalTopic); ok {
+			return topic
+		}
+	}
+	return TopicFromContext(ctx)
+}
+
+type SerializerOption func(s *Serializer)
+
+// WithSchemaRegistry resolves the schema of each topic through registry.
+func WithSchemaRegistry(registry SchemaRegistry) SerializerOption {
+	return func(s *Serializer) {
+		s.registry = registry
+	}
+}
+
+// WithWireFormat frames payloads in the Confluent wire format. It requires a schema registry.
+func WithWireFormat() SerializerOption {
+	return func(s *Serializer) {
+		s.wireFormat = true
+	}
+}
+
+// Serializer encodes message values of a topic with a Codec and the topic's schema.
+type Serializer struct {
+	codec      Codec
+	registry   SchemaRegistry
+	wireFormat bool
+}
+
+func NewSerializer(codec Codec, opts ...SerializerOption) *Serializer {
+	s := &Serializer{codec: codec}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Serialize encodes v with the latest schema of the topic's subject.
+func (s *Serializer) Serialize(ctx context.Context, topic string, v interface{}) ([]byte, error) {
+	var schema *Schema
+	if s.registry != nil {
+		latest, err := s.registry.GetLatest(ctx, SubjectName(topic))
+		if err != nil {
+			return nil, err
+		}
+		schema = &latest
+	} else if s.wireFormat {
+		return nil, ErrSchemaRequired
+	}
+
+	data, err := s.codec.Marshal(schema, v)
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.wireFormat {
+		return data, nil
+	}
+
+	header := make([]byte, wireHeaderLength, wireHeaderLength+1+len(data))
+	header[0] = wireMagicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(schema.ID))
+	if s.codec.Type() == SchemaTypeProtobuf {
+		// message index list: the first message of the schema
+		header = append(header, 0)
+	}
+
+	return append(header, data...), nil
+}
+
+// Deserialize decodes data into v. With the wire format the schema is the one whose ID
+// is in the payload, otherwise the latest schema of the topic's subject.
+func (s *Serializer) Deserialize(ctx context.Context, topic string, data []byte, v interface{}) error {
+	var schema *Schema
+	switch {
+	case s.wireFormat:
+		if s.registry == nil {
+			return ErrSchemaRequired
+		}
+		if len(data) < wireHeaderLength || data[0] != wireMagicByte {
+			return ErrInvalidWireFormat
+		}
+
+		byID, err := s.registry.GetByID(ctx, int(binary.BigEndian.Uint32(data[1:wireHeaderLength])))
+		if err != nil {
+			return err
+		}
+		schema = &byID
+		data = data[wireHeaderLength:]
+
+		if s.codec.Type() == SchemaTypeProtobuf {
+			if data, err = skipMessageIndexes(data); err != nil {
+				return err
+			}
+		}
+
+	case s.registry != nil:
+		latest, err := s.registry.GetLatest(ctx, SubjectName(topic))
+		if err != nil {
+			return err
+		}
+		schema = &latest
+	}
+
+	return s.codec.Unmarshal(schema, data, v)
+}
+
+// skipMessageIndexes drops the protobuf message index list (a zigzag varint count and indexes).
+func skipMessageIndexes(data []byte) ([]byte, error) {
+	count, n := binary.Varint(data)
+	if n <= 0 || count < 0 {
+		return nil, ErrInvalidWireFormat
+	}
+	data = data[n:]
+
+	for i := int64(0); i < count; i++ {
+		if _, n = binary.Varint(data); n <= 0 {
+			return nil, ErrInvalidWireFormat
+		}
+		data = data[n:]
+	}
+
+	return data, nil
+}
+
+// Publish serializes value for the producer's topic and publishes it.
+func Publish[T any](ctx context.Context, producer *Producer, serializer *Serializer, key interface{}, value T) error {
+	data, err := serializer.Serialize(ctx, producer.topic, value)
+	if err != nil {
+		return fmt.Errorf("serialize: %w", err)
+	}
+	return producer.Publish(ctx, key, data)
+}
+
+// OnEvent registers handler on consumer, deserializing each message value into T.
+func OnEvent[T any](consumer *Consumer, serializer *Serializer, handler func(ctx context.Context, key []byte, value T) error) {
+	consumer.OnEvent(func(ctx context.Context, key, value []byte) error {
+		var v T
+		if err := serializer.Deserialize(ctx, OriginalTopicFromContext(ctx), value, &v); err != nil {
+			return fmt.Errorf("deserialize: %w", err)
+		}
+		return handler(ctx, key, v)
+	})
+}
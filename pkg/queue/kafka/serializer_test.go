@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"context"
+	"testing"
+
+	pb "go-source/api/grpc/proto/gen/user"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+func TestSerializer_AvroWireFormat(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+	schema, err := registry.Register(ctx, SubjectName("orders"), Schema{
+		Type:       SchemaTypeAvro,
+		Definition: `{"type":"record","name":"Order","fields":[{"name":"id","type":"string"},{"name":"amount","type":"long"}]}`,
+	})
+	if err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	type order struct {
+		ID     string `json:"id"`
+		Amount int64  `json:"amount"`
+	}
+
+	s := NewSerializer(NewAvroCodec(), WithSchemaRegistry(registry), WithWireFormat())
+	data, err := s.Serialize(ctx, "orders", order{ID: "o-1", Amount: 42})
+	if err != nil {
+		t.Fatalf("Serialize() error = %v", err)
+	}
+	if data[0] != wireMagicByte || int(data[4]) != schema.ID {
+		t.Fatalf("Serialize() header = %v, want schema id %d", data[:wireHeaderLength], schema.ID)
+	}
+
+	var got order
+	if err = s.Deserialize(ctx, "orders", data, &got); err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+	if got.ID != "o-1" || got.Amount != 42 {
+		t.Fatalf("Deserialize() = %+v", got)
+	}
+}
+
+func TestSerializer_ProtobufWireFormat(t *testing.T) {
+	ctx := context.Background()
+	registry := NewMemorySchemaRegistry()
+	if _, err := registry.Register(ctx, SubjectName("users"), Schema{Type: SchemaTypeProtobuf, Definition: "user.User"}); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	s := NewSerializer(ProtobufCodec{}, WithSchemaRegistry(registry), WithWireFormat())
+	data, err := s.Serialize(ctx, "users", &pb.User{Id: "u-1", Email: "a@b.c"})
+	if err != nil {
+		t.Fatalf("Serialize() error = %v", err)
+	}
+
+	var got *pb.User
+	if err = s.Deserialize(ctx, "users", data, &got); err != nil {
+		t.Fatalf("Deserialize() error = %v", err)
+	}
+	if got.GetId() != "u-1" || got.GetEmail() != "a@b.c" {
+		t.Fatalf("Deserialize() = %v", got)
+	}
+}
+
+func TestOriginalTopicFromContext(t *testing.T) {
+	topic, retryTopic := "orders", RetryTopic("orders", 2)
+
+	tests := []struct {
+		name string
+		msg  *kafka.Message
+		want string
+	}{
+		{
+			name: "source topic",
+			msg:  &kafka.Message{TopicPartition: kafka.TopicPartition{Topic: &topic}},
+			want: "orders",
+		},
+		{
+			name: "retry topic",
+			msg: &kafka.Message{
+				TopicPartition: kafka.TopicPartition{Topic: &retryTopic},
+				Headers:        []kafka.Header{{Key: HeaderOriginalTopic, Value: []byte("orders")}},
+			},
+			want: "orders",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OriginalTopicFromContext(messageContext(context.Background(), tt.msg)); got != tt.want {
+				t.Fatalf("OriginalTopicFromContext() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"go-source/pkg/utils"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+)
+
+// headerCarrier adapts message headers to a propagation.TextMapCarrier.
+type headerCarrier struct {
+	headers *[]kafka.Header
+}
+
+func (c headerCarrier) Get(key string) string {
+	value, _ := headerValue(*c.headers, key)
+	return value
+}
+
+// Set replaces every header named key, so a republished message keeps a single value.
+func (c headerCarrier) Set(key, value string) {
+	setHeader(c.headers, key, []byte(value))
+}
+
+func (c headerCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.headers))
+	for _, h := range *c.headers {
+		keys = append(keys, h.Key)
+	}
+	return keys
+}
+
+func setHeader(headers *[]kafka.Header, key string, value []byte) {
+	kept := make([]kafka.Header, 0, len(*headers)+1)
+	for _, h := range *headers {
+		if h.Key != key {
+			kept = append(kept, h)
+		}
+	}
+	*headers = append(kept, kafka.Header{Key: key, Value: value})
+}
+
+// injectTraceHeaders writes the trace info of ctx and its W3C trace context into the message
+// headers. Headers are only written when ctx carries them.
+func injectTraceHeaders(ctx context.Context, msg *kafka.Message) error {
+	if traceInfo := utils.GetRequestIdByContext(ctx); traceInfo != nil {
+		header, err := json.Marshal(traceInfo)
+		if err != nil {
+			return err
+		}
+		setHeader(&msg.Headers, utils.KeyTraceInfo, header)
+	}
+
+	utils.InjectTraceContext(ctx, headerCarrier{headers: &msg.Headers})
+	return nil
+}
+
+// extractTraceHeaders restores the trace info and the W3C trace context of msg. A new request
+// ID, or a new trace, is started when the message has none.
+func extractTraceHeaders(ctx context.Context, msg *kafka.Message) context.Context {
+	newCtx := context.Background()
+
+	if header, ok := headerValue(msg.Headers, utils.KeyTraceInfo); ok {
+		traceInfo := utils.TraceInfo{}
+		if err := json.Unmarshal([]byte(header), &traceInfo); err == nil && traceInfo.RequestID != "" {
+			newCtx = context.WithValue(newCtx, utils.KeyTraceInfo, traceInfo)
+		}
+	}
+
+	if utils.GetRequestIdByContext(newCtx) == nil {
+		newCtx, _ = utils.NewContextWithRequestId(ctx)
+	}
+
+	return utils.ExtractTraceContext(newCtx, headerCarrier{headers: &msg.Headers})
+}
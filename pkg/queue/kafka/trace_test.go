@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"context"
+	"go-source/pkg/utils"
+	"testing"
+
+	"github.com/confluentinc/confluent-kafka-go/kafka"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestTraceHeaders_RoundTrip(t *testing.T) {
+	ctx := context.WithValue(context.Background(), utils.KeyTraceInfo, utils.TraceInfo{RequestID: "req-1"})
+	ctx = utils.ExtractTraceContext(ctx, propagation.MapCarrier{})
+	producerInfo := utils.GetRequestIdByContext(ctx)
+
+	msg := &kafka.Message{Headers: []kafka.Header{{Key: utils.KeyTraceInfo, Value: []byte("stale")}}}
+	if err := injectTraceHeaders(ctx, msg); err != nil {
+		t.Fatalf("injectTraceHeaders() error = %v", err)
+	}
+	if len(msg.Headers) != 2 {
+		t.Fatalf("headers = %v, want trace_info and traceparent once", msg.Headers)
+	}
+
+	got := utils.GetRequestIdByContext(extractTraceHeaders(context.Background(), msg))
+	if got == nil || got.RequestID != "req-1" {
+		t.Fatalf("trace info = %+v, want request id req-1", got)
+	}
+	if got.TraceID != producerInfo.TraceID || got.ParentSpanID != producerInfo.SpanID || got.SpanID == producerInfo.SpanID {
+		t.Fatalf("trace info = %+v, want a child span of %+v", got, producerInfo)
+	}
+
+	empty := &kafka.Message{}
+	if err := injectTraceHeaders(context.Background(), empty); err != nil || len(empty.Headers) != 0 {
+		t.Fatalf("headers = %v, error = %v, want none without trace", empty.Headers, err)
+	}
+}
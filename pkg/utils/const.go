@@ -3,6 +3,7 @@ package utils
 const (
 	PathHealth  = "/health"
 	PathMetrics = "/metrics"
+	PathJWKS    = "/.well-known/jwks.json"
 )
 
 const (
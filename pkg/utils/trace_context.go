@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// W3C trace context headers, propagated next to KeyTraceInfo.
+const (
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+var traceContextPropagator = propagation.TraceContext{}
+
+// ExtractTraceContext restores the W3C trace context of carrier and starts a span of it in
+// ctx, so that the trace context propagated downstream has this hop as parent. A new trace is
+// started when carrier has none. The IDs are copied to the TraceInfo of ctx, so that they are
+// logged with the request ID.
+func ExtractTraceContext(ctx context.Context, carrier propagation.TextMapCarrier) context.Context {
+	parent := trace.SpanContextFromContext(traceContextPropagator.Extract(ctx, carrier))
+
+	var sc trace.SpanContext
+	if parent.IsValid() {
+		sc = parent.WithSpanID(newSpanID()).WithRemote(false)
+	} else {
+		sc = newRootSpanContext()
+	}
+	ctx = trace.ContextWithSpanContext(ctx, sc)
+
+	if traceInfo := GetRequestIdByContext(ctx); traceInfo != nil {
+		traceInfo.TraceID = sc.TraceID().String()
+		traceInfo.SpanID = sc.SpanID().String()
+		traceInfo.ParentSpanID = ""
+		if parent.IsValid() {
+			traceInfo.ParentSpanID = parent.SpanID().String()
+		}
+		ctx = context.WithValue(ctx, KeyTraceInfo, *traceInfo)
+	}
+
+	return ctx
+}
+
+// InjectTraceContext writes the W3C trace context of ctx into carrier. Nothing is written
+// when ctx has no span context.
+func InjectTraceContext(ctx context.Context, carrier propagation.TextMapCarrier) {
+	traceContextPropagator.Inject(ctx, carrier)
+}
+
+func newRootSpanContext() trace.SpanContext {
+	var traceID trace.TraceID
+	_, _ = rand.Read(traceID[:])
+
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     newSpanID(),
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+func newSpanID() trace.SpanID {
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+	return spanID
+}
@@ -15,6 +15,7 @@ import (
 	"golang.org/x/text/unicode/norm"
 
 	"github.com/segmentio/ksuid"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Common errors
@@ -24,6 +25,10 @@ var (
 
 type TraceInfo struct {
 	RequestID string `json:"request_id"`
+	TraceID   string `json:"trace_id,omitempty"`
+	SpanID    string `json:"span_id,omitempty"`
+	// ParentSpanID is the span of the caller, from its traceparent header.
+	ParentSpanID string `json:"parent_span_id,omitempty"`
 }
 
 func GetRequestIdByContext(ctx context.Context) *TraceInfo {
@@ -53,6 +58,10 @@ func NewContextBackgroundFromCtx(ctx context.Context) context.Context {
 		newCtx = context.WithValue(newCtx, KeyTraceInfo, *traceInfo)
 	}
 
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		newCtx = trace.ContextWithSpanContext(newCtx, sc)
+	}
+
 	if region, ok := ctx.Value(KeyRegion).(string); ok {
 		newCtx = context.WithValue(newCtx, KeyRegion, region)
 	}
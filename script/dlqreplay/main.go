@@ -0,0 +1,58 @@
+// Command dlqreplay republishes the messages of <topic>.dlq back to their source topic.
+//
+//	KAFKA_BOOTSTRAP_SERVERS=localhost:9092 KAFKA_GROUP_ID=my-service go run ./script/dlqreplay -topic orders
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/caarlos0/env/v7"
+
+	logger "go-source/pkg/log"
+	"go-source/pkg/queue/kafka"
+)
+
+func main() {
+	logger.InitLog("dlq-replay")
+	log := logger.GetLogger()
+
+	topic := flag.String("topic", "", "source topic whose DLQ is replayed")
+	limit := flag.Int("limit", 0, "maximum number of messages to replay, 0 for all")
+	groupID := flag.String("group", "", "consumer group tracking replay progress, defaults to <KAFKA_GROUP_ID>.dlq-replay")
+	flag.Parse()
+
+	if *topic == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var cfg kafka.KafkaConfig
+	if err := env.Parse(&cfg, env.Options{Prefix: "KAFKA_"}); err != nil {
+		log.Fatal().Err(err).Msg("load kafka config failed")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	producer := kafka.NewProducer(cfg, *topic)
+	replayed, err := kafka.ReplayDLQ(ctx, cfg, *topic, producer, kafka.ReplayOptions{
+		Limit:   *limit,
+		GroupID: *groupID,
+	})
+	closeCtx, closeCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if closeErr := producer.Close(closeCtx); closeErr != nil {
+		log.Error().Err(closeErr).Msg("close producer failed")
+	}
+	closeCancel()
+
+	if err != nil {
+		log.Fatal().Err(err).Int("replayed", replayed).Msg("replay dlq failed")
+	}
+
+	log.Info().Int("replayed", replayed).Msgf("replayed %s", kafka.DLQTopic(*topic))
+}